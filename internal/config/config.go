@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/meowrain/localsend-go/internal/utils/logger"
@@ -15,13 +17,37 @@ import (
 var embeddedConfig embed.FS
 
 type Config struct {
-	DeviceName   string `yaml:"device_name"`
-	NameOfDevice string // Actual device name used in runtime
-	SaveDir      string `yaml:"save_dir"`
-	Functions    struct {
+	DeviceName      string `yaml:"device_name"`
+	NameOfDevice    string // Actual device name used in runtime
+	SaveDir         string `yaml:"save_dir"`
+	Port            int    `yaml:"port"`             // HTTP(S) server port
+	BindAddress     string `yaml:"bind_address"`     // Address the server listens on, empty for all
+	MulticastPort   int    `yaml:"multicast_port"`   // UDP port of the multicast discovery
+	MulticastWindow int    `yaml:"multicast_window"` // Seconds without multicast before UDP broadcast is used too
+	Pin             string `yaml:"pin"`              // PIN required from senders, empty to disable
+	Protocol        string `yaml:"protocol"`         // http or https
+	TLSCert         string `yaml:"tls_cert"`
+	TLSKey          string `yaml:"tls_key"`
+	ConfigDir       string `yaml:"-"` // Directory holding the config and generated state files
+	Functions       struct {
 		HttpFileServer  bool `yaml:"http_file_server"`
 		LocalSendServer bool `yaml:"local_send_server"`
 	} `yaml:"functions"`
+	Peers      []Peer   `yaml:"peers"`      // Devices polled directly when multicast doesn't reach them
+	Interfaces []string `yaml:"interfaces"` // Interface names or CIDRs used for discovery, empty for all
+	MDNS       bool     `yaml:"mdns"`       // Also discover peers via mDNS / DNS-SD
+	Receive    struct {
+		Prompt        bool   `yaml:"prompt"`         // Ask before accepting incoming transfers
+		PromptTimeout int    `yaml:"prompt_timeout"` // Seconds before the default action applies
+		DefaultAction string `yaml:"default_action"` // accept or reject
+		OnConflict    string `yaml:"on_conflict"`    // rename, overwrite, skip or ask
+	} `yaml:"receive"`
+}
+
+// Peer is a statically configured device
+type Peer struct {
+	Host        string `yaml:"host"`        // host or host:port
+	Fingerprint string `yaml:"fingerprint"` // Expected fingerprint, empty to accept any
 }
 
 // random device name
@@ -52,20 +78,24 @@ func generateRandomName() string {
 func LoadConfig(path string) {
 	var bytes []byte
 	var err error
+	configFile := path // Config file read from disk, empty for the embedded one
 
 	if path != "" {
 		bytes, err = os.ReadFile(path)
 		if err != nil {
 			logger.Errorf("Failed to read config file %q: %v, falling back to embedded config", path, err)
+			configFile = ""
 			bytes, err = embeddedConfig.ReadFile("localsend.yaml")
 			if err != nil {
 				logger.Failedf("Can not read embedded config file: %v", err)
 			}
 		}
 	} else {
-		bytes, err = os.ReadFile("localsend.yaml")
+		configFile = "localsend.yaml"
+		bytes, err = os.ReadFile(configFile)
 		if err != nil {
 			logger.Debug("Read localsend.yaml failed, using embedded config. Error: " + err.Error())
+			configFile = ""
 			bytes, err = embeddedConfig.ReadFile("localsend.yaml")
 			if err != nil {
 				logger.Failedf("Can not read embedded config file: %v", err)
@@ -73,6 +103,10 @@ func LoadConfig(path string) {
 		}
 	}
 
+	// Defaults of settings where the zero value isn't the safe choice; the
+	// config file only overrides the keys it sets
+	ConfigData.Receive.Prompt = true
+
 	if err := yaml.Unmarshal(bytes, &ConfigData); err != nil {
 		logger.Failedf("Failed to parse config file: %v", err)
 	}
@@ -90,4 +124,79 @@ func LoadConfig(path string) {
 	if ConfigData.SaveDir == "" {
 		ConfigData.SaveDir = "./uploads"
 	}
+
+	// Default ports of the LocalSend protocol
+	if ConfigData.Port == 0 {
+		ConfigData.Port = 53317
+	}
+	if ConfigData.MulticastPort == 0 {
+		ConfigData.MulticastPort = 53317
+	}
+	if ConfigData.MulticastWindow <= 0 {
+		ConfigData.MulticastWindow = 30
+	}
+
+	// Incoming transfer prompt defaults
+	if ConfigData.Receive.PromptTimeout <= 0 {
+		ConfigData.Receive.PromptTimeout = 30
+	}
+	ConfigData.Receive.DefaultAction = strings.ToLower(ConfigData.Receive.DefaultAction)
+	switch ConfigData.Receive.DefaultAction {
+	case "accept", "reject":
+	case "":
+		ConfigData.Receive.DefaultAction = "accept"
+	default:
+		logger.Errorf("Unknown receive default_action %q in config, using accept", ConfigData.Receive.DefaultAction)
+		ConfigData.Receive.DefaultAction = "accept"
+	}
+	ConfigData.Receive.OnConflict = strings.ToLower(ConfigData.Receive.OnConflict)
+	switch ConfigData.Receive.OnConflict {
+	case "rename", "overwrite", "skip", "ask":
+	case "":
+		ConfigData.Receive.OnConflict = "rename"
+	default:
+		logger.Errorf("Unknown receive on_conflict %q in config, using rename", ConfigData.Receive.OnConflict)
+		ConfigData.Receive.OnConflict = "rename"
+	}
+
+	// Default to HTTPS like the official LocalSend clients
+	ConfigData.Protocol = strings.ToLower(ConfigData.Protocol)
+	switch ConfigData.Protocol {
+	case "http", "https":
+	case "":
+		ConfigData.Protocol = "https"
+	default:
+		logger.Errorf("Unknown protocol %q in config, using https", ConfigData.Protocol)
+		ConfigData.Protocol = "https"
+	}
+	if (ConfigData.TLSCert == "") != (ConfigData.TLSKey == "") {
+		logger.Errorf("tls_cert and tls_key must be set together, using a generated certificate")
+		ConfigData.TLSCert = ""
+		ConfigData.TLSKey = ""
+	}
+
+	// Generated files (certificates, identity, known devices) are stored next
+	// to the config file, or in the user's config directory with the embedded
+	// config so they don't depend on the working directory
+	if configFile != "" {
+		ConfigData.ConfigDir = filepath.Dir(configFile)
+	} else {
+		ConfigData.ConfigDir = defaultConfigDir()
+	}
+}
+
+// defaultConfigDir returns the directory of the generated files when no config
+// file is used, creating it if needed. It falls back to the working directory.
+func defaultConfigDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		logger.Errorf("No user config directory, storing generated files in the working directory: %v", err)
+		return "."
+	}
+	dir = filepath.Join(dir, "localsend-go")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		logger.Errorf("Failed to create %s, storing generated files in the working directory: %v", dir, err)
+		return "."
+	}
+	return dir
 }
@@ -1,8 +1,11 @@
 package discovery
 
 import (
+	"sync/atomic"
 	"time"
 
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
 	"github.com/meowrain/localsend-go/internal/utils/logger"
 
 	"github.com/meowrain/localsend-go/internal/models"
@@ -10,16 +13,69 @@ import (
 
 const (
 	multicastIP   = "224.0.0.167"
-	broadcastPort = 53317
+	multicastIPv6 = "ff02::167" // Link-local scope; joined on each interface
 	httpTimeout   = 2 * time.Second
 	scanInterval  = 2 * time.Second
 	deviceTTL     = 200 * time.Second // Device time-to-live
+	sweepInterval = 10 * time.Second  // How often stale devices are removed
+
+	maxScanInterval = 2 * time.Minute // Slowest HTTP scan rate while multicast works
 )
 
+// lastMulticast holds the time (UnixNano) a peer's multicast packet was last received
+var lastMulticast atomic.Int64
+
+// discoveryStarted is when discovery started; multicast gets a full window to
+// prove it works before the broadcast fallback kicks in
+var discoveryStarted = time.Now()
+
+// multicastWindow returns how recently a peer's multicast packet must have
+// arrived for multicast to count as working
+func multicastWindow() time.Duration {
+	return time.Duration(config.ConfigData.MulticastWindow) * time.Second
+}
+
+// multicastWorking reports whether a peer's multicast packet arrived recently
+func multicastWorking() bool {
+	return time.Since(time.Unix(0, lastMulticast.Load())) < multicastWindow()
+}
+
+// broadcastFallback reports whether announcements should also be sent to the
+// directed broadcast addresses, i.e. no multicast arrived within the window
+func broadcastFallback() bool {
+	return time.Since(discoveryStarted) >= multicastWindow() && !multicastWorking()
+}
+
+// expireDevices periodically removes devices that have not been seen within
+// deviceTTL and notifies the update listeners
+func expireDevices() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		removed := shared.RemoveStale(deviceTTL)
+		if len(removed) == 0 {
+			continue
+		}
+		logger.Debugf("Removed stale devices: %v", removed)
+		shared.NotifyUpdate()
+	}
+}
+
+// ListenAndStartBroadcasts starts every enabled discovery transport, along
+// with the expiry and persistence of the device registry
 func ListenAndStartBroadcasts(updates chan<- []models.SendModel) {
-	logger.Info("Listening for broadcasts...")
-	go ListenForUDPBroadcasts(updates)
-	go ListenForHttpBroadCast(updates)
-	logger.Info("Start broadcasts...")
-	go StartUDPBroadcast()
+	shared.AddUpdateListener(updates)
+	discoveryStarted = time.Now()
+	for _, transport := range transports() {
+		logger.Infof("Starting %s discovery...", transport.Name())
+		go func(transport Transport) {
+			if err := transport.Run(updates); err != nil {
+				logger.Errorf("%s discovery stopped: %v", transport.Name(), err)
+			}
+		}(transport)
+	}
+	go expireDevices()
+	go restoreKnownDevices()
+	go persistKnownDevices()
 }
@@ -1,19 +1,43 @@
 package discovery
 
 import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+)
 
-	probing "github.com/prometheus-community/pro-bing"
+const (
+	minScanPrefix   = 22               // Larger subnets are narrowed to the /22 around our address
+	scanWorkers     = 64               // Concurrent /info probes
+	idleConnTimeout = 30 * time.Second // How long kept-alive connections to peers stay open
 )
 
-// GetLocalIP returns all local IPv4 addresses
-func GetLocalIP() ([]net.IP, error) {
-	ips := make([]net.IP, 0)
+// httpClient is shared by all discovery requests, so connections to peers that
+// are probed again and again are reused and idle ones are eventually closed
+var httpClient = &http.Client{
+	Timeout: httpTimeout,
+	Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		IdleConnTimeout: idleConnTimeout,
+	},
+}
+
+// GetLocalIP returns all non-loopback local addresses, IPv4 and IPv6, with
+// their subnet mask
+func GetLocalIP() ([]*net.IPNet, error) {
+	ips := make([]*net.IPNet, 0)
 	ifaces, err := net.Interfaces()
 	if err != nil {
 		return nil, err
@@ -28,8 +52,8 @@ func GetLocalIP() ([]net.IP, error) {
 		for _, addr := range addrs {
 			switch v := addr.(type) {
 			case *net.IPNet:
-				if v.IP.To4() != nil && !v.IP.IsLoopback() {
-					ips = append(ips, v.IP)
+				if !v.IP.IsLoopback() {
+					ips = append(ips, v)
 				}
 			}
 		}
@@ -37,53 +61,128 @@ func GetLocalIP() ([]net.IP, error) {
 	return ips, nil
 }
 
-// pingScan uses ICMP ping to scan all active devices on the local network
-func pingScan() ([]string, error) {
-	var ips []string
-	ipGroup, err := GetLocalIP()
+// hostsToScan lists the host addresses of the subnet of ipNet, except ipNet.IP
+// itself. Subnets larger than minScanPrefix are narrowed around our address.
+func hostsToScan(ipNet *net.IPNet) []string {
+	ip4 := ipNet.IP.To4()
+	ones, bits := ipNet.Mask.Size()
+	if ip4 == nil || bits != 32 || ones >= 31 {
+		return nil // Not IPv4, or a point-to-point link
+	}
+	if ones < minScanPrefix {
+		ones = minScanPrefix
+	}
+
+	self := binary.BigEndian.Uint32(ip4)
+	network := self & (^uint32(0) << (32 - ones))
+	size := uint32(1) << (32 - ones)
+
+	hosts := make([]string, 0, size-2)
+	for i := uint32(1); i < size-1; i++ { // Skip network and broadcast addresses
+		addr := network + i
+		if addr == self {
+			continue
+		}
+		host := make(net.IP, 4)
+		binary.BigEndian.PutUint32(host, addr)
+		hosts = append(hosts, host.String())
+	}
+	return hosts
+}
+
+// probeInfo asks device for its info. Our fingerprint is passed along so a
+// node probing itself gets 412 instead of an answer.
+func probeInfo(device models.SendModel) (*models.BroadcastMessage, error) {
+	resp, err := httpClient.Get(device.URL("/api/localsend/v2/info?fingerprint=" + url.QueryEscape(shared.Message.Fingerprint)))
 	if err != nil {
 		return nil, err
 	}
-	for _, i := range ipGroup {
-		ip := i.Mask(net.IPv4Mask(255, 255, 255, 0)) // Assumes /24 subnet mask
-		ip4 := ip.To4()
-		if ip4 == nil {
-			return nil, fmt.Errorf("invalid IPv4 address")
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("info failed: received status code %d", resp.StatusCode)
+	}
+
+	var info models.BroadcastMessage
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to parse info response: %w", err)
+	}
+	if info.Port == 0 {
+		info.Port = device.Port
+	}
+	if info.Protocol == "" {
+		info.Protocol = device.Protocol
+	}
+	info.LastSeen = time.Now()
+	return &info, nil
+}
+
+// probeHost checks whether a LocalSend server runs at device. Unknown hosts
+// are tried over HTTPS first and over HTTP when they answer with plain HTTP.
+func probeHost(device models.SendModel) (*models.BroadcastMessage, error) {
+	info, err := probeInfo(device)
+	if err != nil && device.Protocol == "https" && isPlainHTTP(err) {
+		device.Protocol = "http"
+		info, err = probeInfo(device)
+		if err == nil {
+			info.Protocol = device.Protocol // Whatever the peer advertises
 		}
+	}
+	return info, err
+}
 
-		var wg sync.WaitGroup
-		var mu sync.Mutex
+// isPlainHTTP reports whether err comes from an HTTPS request answered with
+// plain HTTP. net/http replaces the TLS record error with its own message.
+func isPlainHTTP(err error) bool {
+	var recordErr tls.RecordHeaderError
+	return errors.As(err, &recordErr) || strings.Contains(err.Error(), "server gave HTTP response to HTTPS client")
+}
 
-		for i := 1; i < 255; i++ {
-			ip4[3] = byte(i)
-			targetIP := ip4.String()
+// probeScan probes every host of our local subnets with a bounded number of
+// workers and returns the LocalSend devices that answered, keyed by IP
+func probeScan() (map[string]models.BroadcastMessage, error) {
+	var ipNets []*net.IPNet
+	if len(config.ConfigData.Interfaces) > 0 {
+		ipNets = interfaceNets(multicastInterfaces())
+	} else {
+		var err error
+		if ipNets, err = GetLocalIP(); err != nil {
+			return nil, err
+		}
+	}
 
-			wg.Add(1)
-			go func(ip string) {
-				defer wg.Done()
-				pinger, err := probing.NewPinger(ip)
-				if err != nil {
-					logger.Errorf("Failed to create pinger:", err)
-					return
-				}
-				pinger.SetPrivileged(true)
-				pinger.Count = 1
-				pinger.Timeout = time.Second * 1
-
-				pinger.OnRecv = func(pkt *probing.Packet) {
-					mu.Lock()
-					ips = append(ips, ip)
-					mu.Unlock()
-				}
-				err = pinger.Run()
+	jobs := make(chan string)
+	found := make(map[string]models.BroadcastMessage)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < scanWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range jobs {
+				info, err := probeHost(shared.LookupDevice(ip))
 				if err != nil {
-					// Ignore ping send failures
-					return
+					continue
 				}
-			}(targetIP)
-		}
+				mu.Lock()
+				found[ip] = *info
+				mu.Unlock()
+			}
+		}()
+	}
 
-		wg.Wait()
+	seen := make(map[string]bool)
+	for _, ipNet := range ipNets {
+		for _, ip := range hostsToScan(ipNet) {
+			if !seen[ip] {
+				seen[ip] = true
+				jobs <- ip
+			}
+		}
 	}
-	return ips, nil
+	close(jobs)
+	wg.Wait()
+
+	return found, nil
 }
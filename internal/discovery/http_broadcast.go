@@ -2,7 +2,6 @@ package discovery
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,85 +14,99 @@ import (
 	"github.com/meowrain/localsend-go/internal/utils/logger"
 )
 
+// registerWith POSTs our device info to the register endpoint of device and
+// returns its answer
+func registerWith(device models.SendModel) (*models.BroadcastMessage, error) {
+	data, err := json.Marshal(shared.LocalInfo())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", device.URL("/api/localsend/v2/register"), bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("register failed: received status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTTP response body: %w", err)
+	}
+
+	var response models.BroadcastMessage
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse HTTP response: %w", err)
+	}
+
+	// The register response may omit how to reach the device
+	if response.Port == 0 {
+		response.Port = device.Port
+	}
+	if response.Protocol == "" {
+		response.Protocol = device.Protocol
+	}
+	response.LastSeen = time.Now()
+	return &response, nil
+}
+
+// ListenForHttpBroadCast periodically probes the local subnets for LocalSend
+// devices and registers with the ones it finds. Scans back off while
+// multicast discovery is working.
 func ListenForHttpBroadCast(updates chan<- []models.SendModel) {
-	ticker := time.NewTicker(scanInterval)
-	defer ticker.Stop()
+	interval := scanInterval
 
-	for range ticker.C {
-		data, err := json.Marshal(shared.Message)
-		if err != nil {
-			logger.Errorf("Failed to marshal message: %v", err)
-			continue
-		}
+	for {
+		time.Sleep(interval)
 
-		ips, err := pingScan()
+		found, err := probeScan()
 		if err != nil {
-			logger.Errorf("Failed to discover devices via ping scan: %v", err)
+			logger.Errorf("Failed to discover devices via HTTP scan: %v", err)
 			continue
 		}
 
 		var wg sync.WaitGroup
-		for _, ip := range ips {
+		for ip, info := range found {
+			if !shared.AddDevice(ip, info) {
+				continue
+			}
 			wg.Add(1)
 			go func(ip string) {
 				defer wg.Done()
-				url := fmt.Sprintf("https://%s:%d/api/localsend/v2/register", ip, broadcastPort)
-				req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
-				if err != nil {
-					logger.Errorf("Failed to create HTTP request for %s: %v", ip, err)
-					return
-				}
-				req.Header.Set("Content-Type", "application/json")
-
-				client := &http.Client{
-					Timeout: httpTimeout,
-					Transport: &http.Transport{
-						TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-					},
-				}
-
-				resp, err := client.Do(req)
-				if err != nil {
-					return
-				}
-				defer resp.Body.Close()
-
-				body, err := io.ReadAll(resp.Body)
+				// Let the device know about us as well
+				response, err := registerWith(shared.LookupDevice(ip))
 				if err != nil {
-					logger.Errorf("Failed to read HTTP response body from %s: %v", ip, err)
-					return
-				}
-
-				var response models.BroadcastMessage
-				if err := json.Unmarshal(body, &response); err != nil {
-					logger.Errorf("Failed to parse HTTP response from %s: %v", ip, err)
+					logger.Debugf("Failed to register with %s: %v", ip, err)
 					return
 				}
 
-				response.LastSeen = time.Now()
-
-				shared.DevicesMutex.Lock()
-				shared.DiscoveredDevices[ip] = response
-				shared.DevicesMutex.Unlock()
+				shared.AddDevice(ip, *response)
 			}(ip)
 		}
 
 		wg.Wait()
 
-		shared.DevicesMutex.RLock()
-		devices := make([]models.SendModel, 0, len(shared.DiscoveredDevices))
-		for ip, device := range shared.DiscoveredDevices {
-			devices = append(devices, models.SendModel{
-				IP:         ip,
-				DeviceName: device.Alias,
-			})
-		}
-		shared.DevicesMutex.RUnlock()
+		devices := shared.DeviceList()
 
 		select {
 		case updates <- devices:
 		default:
 			logger.Debug("Updates channel is full, skipping update")
 		}
+
+		if multicastWorking() {
+			interval = min(interval*2, maxScanInterval)
+		} else {
+			interval = scanInterval
+		}
 	}
 }
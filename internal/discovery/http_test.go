@@ -0,0 +1,38 @@
+package discovery
+
+import (
+	"net"
+	"testing"
+)
+
+func TestHostsToScan(t *testing.T) {
+	tests := []struct {
+		cidr  string
+		count int
+	}{
+		{"192.168.1.10/24", 253}, // 254 hosts minus ourselves
+		{"192.168.1.10/28", 13},  // Small subnets are not widened to /24
+		{"10.1.2.3/8", 1021},     // Large subnets are capped at /22
+		{"192.168.1.10/31", 0},   // Point-to-point link
+		{"192.168.1.10/32", 0},   // Single address
+		{"fd00::2/64", 0},        // IPv6 is not swept
+	}
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			ip, ipNet, err := net.ParseCIDR(tt.cidr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ipNet.IP = ip
+			hosts := hostsToScan(ipNet)
+			if len(hosts) != tt.count {
+				t.Fatalf("got %d hosts, want %d", len(hosts), tt.count)
+			}
+			for _, host := range hosts {
+				if host == ip.String() {
+					t.Fatal("own address is scanned")
+				}
+			}
+		})
+	}
+}
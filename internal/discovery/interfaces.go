@@ -0,0 +1,158 @@
+package discovery
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// unmatchedWarned records the interface specs already reported as matching
+// nothing, so the warning isn't repeated on every scan
+var unmatchedWarned sync.Map
+
+// matchInterface reports whether spec selects an interface. spec is either an
+// interface name or a CIDR containing one of the interface's addresses.
+func matchInterface(spec string, name string, addrs []net.Addr) bool {
+	if !strings.Contains(spec, "/") {
+		return spec == name
+	}
+	_, network, err := net.ParseCIDR(spec)
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && network.Contains(ipNet.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// multicastInterfaces returns the interfaces discovery runs on: those
+// selected by the interfaces config option, or every multicast-capable
+// interface that is up when the option is empty. An empty result means the
+// system default interface should be used.
+func multicastInterfaces() []net.Interface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		logger.Errorf("Failed to list network interfaces: %v", err)
+		return nil
+	}
+
+	specs := config.ConfigData.Interfaces
+	matched := make(map[string]bool)
+	selected := make([]net.Interface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		if len(specs) == 0 {
+			if iface.Flags&net.FlagLoopback == 0 {
+				selected = append(selected, iface)
+			}
+			continue
+		}
+
+		addrs, _ := iface.Addrs()
+		for _, spec := range specs {
+			if matchInterface(spec, iface.Name, addrs) {
+				matched[spec] = true
+				selected = append(selected, iface)
+				break
+			}
+		}
+	}
+
+	for _, spec := range specs {
+		if matched[spec] {
+			continue
+		}
+		if _, warned := unmatchedWarned.LoadOrStore(spec, true); !warned {
+			logger.Warnf("Interface %q does not match any multicast-capable interface", spec)
+		}
+	}
+	return selected
+}
+
+// withFamily returns the interfaces among ifaces that have an IPv6 address if
+// v6 is set, or an IPv4 address otherwise
+func withFamily(ifaces []net.Interface, v6 bool) []net.Interface {
+	selected := make([]net.Interface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && (ipNet.IP.To4() == nil) == v6 {
+				selected = append(selected, iface)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// directedBroadcast returns the broadcast address of an IPv4 network, or nil
+// for IPv6 and point-to-point networks
+func directedBroadcast(ipNet *net.IPNet) net.IP {
+	ip4 := ipNet.IP.To4()
+	ones, bits := ipNet.Mask.Size()
+	if ip4 == nil || bits != 32 || ones >= 31 {
+		return nil
+	}
+	broadcast := make(net.IP, 4)
+	for i := range ip4 {
+		broadcast[i] = ip4[i] | ^ipNet.Mask[i]
+	}
+	return broadcast
+}
+
+// broadcastAddrs returns the directed broadcast addresses of ifaces
+func broadcastAddrs(ifaces []net.Interface) []net.IP {
+	var addrs []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		for _, ipNet := range interfaceNets([]net.Interface{iface}) {
+			if broadcast := directedBroadcast(ipNet); broadcast != nil {
+				addrs = append(addrs, broadcast)
+			}
+		}
+	}
+	return addrs
+}
+
+// interfaceNets returns the IPv4 networks of ifaces
+func interfaceNets(ifaces []net.Interface) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(ifaces))
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				nets = append(nets, ipNet)
+			}
+		}
+	}
+	return nets
+}
+
+// interfaceName returns the name of the interface with the given index, or
+// an empty string if it is unknown
+func interfaceName(index int) string {
+	if index == 0 {
+		return ""
+	}
+	iface, err := net.InterfaceByIndex(index)
+	if err != nil {
+		return ""
+	}
+	return iface.Name
+}
@@ -0,0 +1,55 @@
+package discovery
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMatchInterface(t *testing.T) {
+	addrs := []net.Addr{
+		&net.IPNet{IP: net.ParseIP("192.168.1.20"), Mask: net.CIDRMask(24, 32)},
+		&net.IPNet{IP: net.ParseIP("fd00::2"), Mask: net.CIDRMask(64, 128)},
+	}
+
+	tests := []struct {
+		spec string
+		want bool
+	}{
+		{"eth0", true},
+		{"wlan0", false},
+		{"192.168.1.0/24", true},
+		{"192.168.0.0/16", true},
+		{"10.0.0.0/8", false},
+		{"fd00::/8", true},
+		{"192.168.1.0/33", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchInterface(tt.spec, "eth0", addrs); got != tt.want {
+			t.Errorf("matchInterface(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestDirectedBroadcast(t *testing.T) {
+	tests := []struct {
+		cidr string
+		want string
+	}{
+		{"192.168.1.20/24", "192.168.1.255"},
+		{"10.1.2.3/8", "10.255.255.255"},
+		{"172.16.5.4/22", "172.16.7.255"},
+		{"192.168.1.20/31", ""}, // Point-to-point link
+		{"192.168.1.20/32", ""},
+		{"fd00::2/64", ""},
+	}
+
+	for _, tt := range tests {
+		ip, ipNet, _ := net.ParseCIDR(tt.cidr)
+		ipNet.IP = ip
+		got := directedBroadcast(ipNet)
+		if (got == nil && tt.want != "") || (got != nil && got.String() != tt.want) {
+			t.Errorf("directedBroadcast(%s) = %v, want %q", tt.cidr, got, tt.want)
+		}
+	}
+}
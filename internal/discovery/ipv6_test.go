@@ -0,0 +1,101 @@
+package discovery
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// newIPv6Server starts a fake LocalSend peer listening on [::1]
+func newIPv6Server(t *testing.T, tls bool) *httptest.Server {
+	t.Helper()
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(models.BroadcastMessage{
+			Alias:       "IPv6 Peer",
+			DeviceType:  "desktop",
+			Fingerprint: "ipv6-peer",
+		})
+	}))
+	server.Listener = listener
+	if tls {
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProbeHostIPv6Loopback(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		tls  bool
+		want string
+	}{
+		{"https", true, "https"},
+		{"http fallback", false, "http"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newIPv6Server(t, tt.tls)
+			port := server.Listener.Addr().(*net.TCPAddr).Port
+
+			info, err := probeHost(models.SendModel{IP: "::1", Port: port, Protocol: "https"})
+			if err != nil {
+				t.Fatalf("probeHost: %v", err)
+			}
+			if info.Alias != "IPv6 Peer" || info.Port != port || info.Protocol != tt.want {
+				t.Fatalf("probeHost = %+v, want alias %q on %s port %d", info, "IPv6 Peer", tt.want, port)
+			}
+		})
+	}
+}
+
+func TestResolvePeerIPv6(t *testing.T) {
+	shared.AddDevice("::1", models.BroadcastMessage{
+		Alias:       "Loopback",
+		DeviceType:  "desktop",
+		Fingerprint: "loopback-peer",
+		Port:        8080,
+		Protocol:    "http",
+		LastSeen:    time.Now(),
+	})
+	t.Cleanup(func() {
+		shared.DevicesMutex.Lock()
+		delete(shared.DiscoveredDevices, "::1")
+		shared.DevicesMutex.Unlock()
+	})
+
+	tests := []struct {
+		target string
+		ip     string
+		port   int
+	}{
+		{"::1", "::1", 8080},
+		{"[::1]", "::1", 8080},
+		{"[::1]:9000", "::1", 9000},
+		{"Loopback", "::1", 8080},
+		{"fe80::1%nosuchif0", "fe80::1%nosuchif0", models.DefaultPort},
+		{"[fe80::1%nosuchif0]:9000", "fe80::1%nosuchif0", 9000},
+	}
+	for _, tt := range tests {
+		device, err := ResolvePeer(tt.target, 0)
+		if err != nil {
+			t.Errorf("ResolvePeer(%q): %v", tt.target, err)
+			continue
+		}
+		if device.IP != tt.ip || device.Port != tt.port {
+			t.Errorf("ResolvePeer(%q) = %s port %d, want %s port %d", tt.target, device.IP, device.Port, tt.ip, tt.port)
+		}
+	}
+}
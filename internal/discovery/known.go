@@ -0,0 +1,246 @@
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+const (
+	knownDevicesFile  = "localsend-devices.json"
+	knownDeviceTTL    = 30 * 24 * time.Hour // Devices not seen for this long are forgotten
+	knownSaveInterval = 5 * time.Second     // How often the registry is checked for changes
+	knownRefresh      = time.Minute         // Last-seen times alone are saved at most this often
+)
+
+// KnownDevice is a device remembered across runs
+type KnownDevice struct {
+	Fingerprint string    `json:"fingerprint"`
+	Alias       string    `json:"alias"`
+	IP          string    `json:"ip"`
+	Port        int       `json:"port"`
+	Protocol    string    `json:"protocol"`
+	LastSeen    time.Time `json:"lastSeen"`
+}
+
+var (
+	knownMutex sync.Mutex
+	lastSaved  time.Time
+)
+
+func knownDevicesPath() string {
+	return filepath.Join(config.ConfigData.ConfigDir, knownDevicesFile)
+}
+
+// LoadKnownDevices returns the remembered devices, most recently seen first
+func LoadKnownDevices() ([]KnownDevice, error) {
+	data, err := os.ReadFile(knownDevicesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []KnownDevice
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, err
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].LastSeen.After(devices[j].LastSeen)
+	})
+	return devices, nil
+}
+
+// writeKnownDevices replaces the state file. The file is written next to the
+// old one and renamed so concurrent readers never see half of it.
+func writeKnownDevices(devices []KnownDevice) error {
+	data, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := knownDevicesPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+knownDevicesFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// mergeKnownDevices adds the devices of the registry to the remembered ones,
+// keyed by fingerprint, and drops those not seen within knownDeviceTTL
+func mergeKnownDevices(known []KnownDevice, registry map[string]models.BroadcastMessage) []KnownDevice {
+	byFingerprint := make(map[string]KnownDevice, len(known)+len(registry))
+	for _, device := range known {
+		byFingerprint[device.Fingerprint] = device
+	}
+	for ip, device := range registry {
+		if device.Fingerprint == "" {
+			continue
+		}
+		if existing, ok := byFingerprint[device.Fingerprint]; ok && existing.LastSeen.After(device.LastSeen) {
+			continue
+		}
+		byFingerprint[device.Fingerprint] = KnownDevice{
+			Fingerprint: device.Fingerprint,
+			Alias:       device.Alias,
+			IP:          ip,
+			Port:        device.Port,
+			Protocol:    device.Protocol,
+			LastSeen:    device.LastSeen,
+		}
+	}
+
+	merged := make([]KnownDevice, 0, len(byFingerprint))
+	for _, device := range byFingerprint {
+		if time.Since(device.LastSeen) <= knownDeviceTTL {
+			merged = append(merged, device)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].LastSeen.After(merged[j].LastSeen)
+	})
+	return merged
+}
+
+// withoutLastSeen strips the last-seen times so saves can be skipped when
+// nothing but those changed
+func withoutLastSeen(devices []KnownDevice) []KnownDevice {
+	stripped := make([]KnownDevice, len(devices))
+	for i, device := range devices {
+		device.LastSeen = time.Time{}
+		stripped[i] = device
+	}
+	sort.Slice(stripped, func(i, j int) bool {
+		return stripped[i].Fingerprint < stripped[j].Fingerprint
+	})
+	return stripped
+}
+
+// SaveKnownDevices merges the discovered devices into the state file
+func SaveKnownDevices() error {
+	return saveKnownDevices(true)
+}
+
+func saveKnownDevices(force bool) error {
+	knownMutex.Lock()
+	defer knownMutex.Unlock()
+
+	known, err := LoadKnownDevices()
+	if err != nil {
+		logger.Warnf("Ignoring unreadable device state file: %v", err)
+	}
+
+	shared.DevicesMutex.RLock()
+	merged := mergeKnownDevices(known, shared.DiscoveredDevices)
+	shared.DevicesMutex.RUnlock()
+
+	changed := !reflect.DeepEqual(withoutLastSeen(known), withoutLastSeen(merged))
+	if !force && !changed && time.Since(lastSaved) < knownRefresh {
+		return nil
+	}
+	if len(merged) == 0 && len(known) == 0 {
+		return nil
+	}
+	if err := writeKnownDevices(merged); err != nil {
+		return err
+	}
+	lastSaved = time.Now()
+	return nil
+}
+
+// persistKnownDevices keeps the state file up to date with the registry
+func persistKnownDevices() {
+	ticker := time.NewTicker(knownSaveInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := saveKnownDevices(false); err != nil {
+			logger.Errorf("Failed to save known devices: %v", err)
+		}
+	}
+}
+
+// restoreKnownDevices checks the remembered devices with a quick /info call,
+// in parallel, and adds those that answer with the expected fingerprint
+func restoreKnownDevices() {
+	known, err := LoadKnownDevices()
+	if err != nil {
+		logger.Warnf("Failed to load known devices: %v", err)
+		return
+	}
+
+	for _, device := range known {
+		go func(device KnownDevice) {
+			info, err := probeHost(models.SendModel{
+				DeviceName: device.Alias,
+				IP:         device.IP,
+				Port:       device.Port,
+				Protocol:   device.Protocol,
+			})
+			if err != nil {
+				logger.Debugf("Known device %s (%s) is not reachable: %v", device.Alias, device.IP, err)
+				return
+			}
+			if info.Fingerprint != device.Fingerprint {
+				logger.Debugf("%s is no longer %s", device.IP, device.Alias)
+				return
+			}
+			if shared.AddDevice(device.IP, *info) {
+				shared.NotifyUpdate()
+			}
+		}(device)
+	}
+}
+
+// ForgetKnownDevices removes the remembered devices whose fingerprint, alias
+// or IP is target, or all of them if target is empty, and returns them
+func ForgetKnownDevices(target string) ([]KnownDevice, error) {
+	knownMutex.Lock()
+	defer knownMutex.Unlock()
+
+	known, err := LoadKnownDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	var kept, forgotten []KnownDevice
+	for _, device := range known {
+		if target == "" || device.Fingerprint == target || device.IP == target || strings.EqualFold(device.Alias, target) {
+			forgotten = append(forgotten, device)
+		} else {
+			kept = append(kept, device)
+		}
+	}
+	if len(forgotten) == 0 {
+		return nil, nil
+	}
+	if kept == nil {
+		kept = []KnownDevice{}
+	}
+	return forgotten, writeKnownDevices(kept)
+}
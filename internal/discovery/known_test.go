@@ -0,0 +1,63 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestMergeKnownDevices(t *testing.T) {
+	now := time.Now()
+	known := []KnownDevice{
+		{Fingerprint: "moved", Alias: "Laptop", IP: "192.168.1.10", LastSeen: now.Add(-time.Hour)},
+		{Fingerprint: "kept", Alias: "Phone", IP: "192.168.1.11", LastSeen: now.Add(-time.Hour)},
+		{Fingerprint: "old", Alias: "Tablet", IP: "192.168.1.12", LastSeen: now.Add(-2 * knownDeviceTTL)},
+	}
+	registry := map[string]models.BroadcastMessage{
+		"192.168.1.20": {Alias: "Laptop", Fingerprint: "moved", Port: 53317, Protocol: "https", LastSeen: now},
+		"192.168.1.21": {Alias: "Anonymous", LastSeen: now},
+	}
+
+	merged := mergeKnownDevices(known, registry)
+	if len(merged) != 2 {
+		t.Fatalf("merged %d devices, want 2: %+v", len(merged), merged)
+	}
+	if merged[0].Fingerprint != "moved" || merged[0].IP != "192.168.1.20" || merged[0].Port != 53317 {
+		t.Errorf("moved device not updated: %+v", merged[0])
+	}
+	if merged[1].Fingerprint != "kept" {
+		t.Errorf("remembered device lost: %+v", merged[1])
+	}
+}
+
+func TestForgetKnownDevices(t *testing.T) {
+	configDir := config.ConfigData.ConfigDir
+	config.ConfigData.ConfigDir = t.TempDir()
+	t.Cleanup(func() { config.ConfigData.ConfigDir = configDir })
+	now := time.Now()
+	err := writeKnownDevices([]KnownDevice{
+		{Fingerprint: "a", Alias: "Laptop", IP: "192.168.1.10", LastSeen: now},
+		{Fingerprint: "b", Alias: "Phone", IP: "192.168.1.11", LastSeen: now.Add(-time.Minute)},
+		{Fingerprint: "c", Alias: "NAS", IP: "fd00::5", LastSeen: now.Add(-2 * time.Minute)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []string{"a", "phone", "fd00::5"} {
+		forgotten, err := ForgetKnownDevices(target)
+		if err != nil || len(forgotten) != 1 {
+			t.Fatalf("ForgetKnownDevices(%q) = %+v, %v", target, forgotten, err)
+		}
+	}
+	if forgotten, _ := ForgetKnownDevices("unknown"); forgotten != nil {
+		t.Fatalf("forgot unknown device: %+v", forgotten)
+	}
+
+	devices, err := LoadKnownDevices()
+	if err != nil || len(devices) != 0 {
+		t.Fatalf("LoadKnownDevices = %+v, %v; want none", devices, err)
+	}
+}
@@ -0,0 +1,189 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/grandcat/zeroconf"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+const (
+	mdnsService = "_localsend._tcp"
+	mdnsDomain  = "local."
+	// Browsing restarts this often so peers are reported again before they
+	// expire from the registry
+	mdnsBrowseInterval = time.Minute
+)
+
+// mdnsTransport advertises a _localsend._tcp service and browses for peers
+type mdnsTransport struct{}
+
+func (mdnsTransport) Name() string { return "mDNS" }
+
+func (mdnsTransport) Run(updates chan<- []models.SendModel) error {
+	ifaces := multicastInterfaces()
+	message := shared.Message
+
+	server, err := zeroconf.Register(instanceName(message), mdnsService, mdnsDomain, message.Port, messageToTXT(message), ifaces)
+	if err != nil {
+		return fmt.Errorf("failed to advertise service: %w", err)
+	}
+	defer server.Shutdown()
+
+	for {
+		if err := browseMDNS(ifaces, updates); err != nil {
+			logger.Errorf("mDNS browse failed: %v", err)
+			// Browsing fails right away e.g. without a usable interface
+			time.Sleep(mdnsBrowseInterval)
+		}
+	}
+}
+
+// instanceName returns the service instance name of message's device: the
+// alias followed by the start of the fingerprint, since aliases need not be
+// unique. DNS labels are limited to 63 bytes, so long aliases are cut.
+func instanceName(message models.BroadcastMessage) string {
+	suffix := fmt.Sprintf(" (%.8s)", message.Fingerprint)
+	alias := message.Alias
+	for len(alias)+len(suffix) > 63 {
+		_, size := utf8.DecodeLastRuneInString(alias)
+		alias = alias[:len(alias)-size]
+	}
+	return alias + suffix
+}
+
+// browseMDNS adds the peers advertising the LocalSend service during one
+// browse interval
+func browseMDNS(ifaces []net.Interface, updates chan<- []models.SendModel) error {
+	var options []zeroconf.ClientOption
+	if len(ifaces) > 0 {
+		options = append(options, zeroconf.SelectIfaces(ifaces))
+	}
+	resolver, err := zeroconf.NewResolver(options...)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mdnsBrowseInterval)
+	defer cancel()
+
+	entries := make(chan *zeroconf.ServiceEntry)
+	// The resolver closes entries when it's done, but stopping on ctx too
+	// keeps this from leaking if a failed Browse never does
+	go func() {
+		for {
+			select {
+			case entry, ok := <-entries:
+				if !ok {
+					return
+				}
+				addMDNSEntry(entry, updates)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	if err := resolver.Browse(ctx, mdnsService, mdnsDomain, entries); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// addMDNSEntry records the device advertised by entry
+func addMDNSEntry(entry *zeroconf.ServiceEntry, updates chan<- []models.SendModel) {
+	message, err := messageFromTXT(entry.Text)
+	if err != nil {
+		logger.Debugf("Invalid mDNS service %s: %v", entry.Instance, err)
+		return
+	}
+	if message.Port == 0 {
+		message.Port = entry.Port
+	}
+	message.LastSeen = time.Now()
+
+	ip := entryIP(entry)
+	if ip == "" {
+		logger.Debugf("mDNS service %s has no usable address", entry.Instance)
+		return
+	}
+	if !shared.AddDevice(ip, message) {
+		return
+	}
+	logger.Debugf("Discovered %s (%s) via mDNS", message.Alias, ip)
+
+	select {
+	case updates <- shared.DeviceList():
+	default:
+		logger.Debug("Updates channel is full, skipping update")
+	}
+}
+
+// entryIP picks the address of an mDNS entry: IPv4 if there is one, else a
+// routable IPv6 address. Link-local IPv6 addresses come without a zone and
+// can't be used.
+func entryIP(entry *zeroconf.ServiceEntry) string {
+	if len(entry.AddrIPv4) > 0 {
+		return entry.AddrIPv4[0].String()
+	}
+	for _, ip := range entry.AddrIPv6 {
+		if !ip.IsLinkLocalUnicast() {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// messageToTXT encodes the fields of a broadcast message as TXT records
+func messageToTXT(message models.BroadcastMessage) []string {
+	return []string{
+		"alias=" + message.Alias,
+		"version=" + message.Version,
+		"deviceModel=" + message.DeviceModel,
+		"deviceType=" + message.DeviceType,
+		"fingerprint=" + message.Fingerprint,
+		"port=" + strconv.Itoa(message.Port),
+		"protocol=" + message.Protocol,
+		"download=" + strconv.FormatBool(message.Download),
+	}
+}
+
+// messageFromTXT decodes the TXT records written by messageToTXT, with the
+// same required fields as multicast announcements
+func messageFromTXT(records []string) (models.BroadcastMessage, error) {
+	var message models.BroadcastMessage
+	for _, record := range records {
+		key, value, _ := strings.Cut(record, "=")
+		switch key {
+		case "alias":
+			message.Alias = value
+		case "version":
+			message.Version = value
+		case "deviceModel":
+			message.DeviceModel = value
+		case "deviceType":
+			message.DeviceType = value
+		case "fingerprint":
+			message.Fingerprint = value
+		case "port":
+			message.Port, _ = strconv.Atoi(value)
+		case "protocol":
+			message.Protocol = value
+		case "download":
+			message.Download = value == "true"
+		}
+	}
+
+	if message.Alias == "" || message.DeviceType == "" {
+		return message, fmt.Errorf("missing required fields")
+	}
+	return message, nil
+}
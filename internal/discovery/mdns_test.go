@@ -0,0 +1,57 @@
+package discovery
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestMessageTXTRoundTrip(t *testing.T) {
+	message := models.BroadcastMessage{
+		Alias:       "Happy Phoenix",
+		Version:     "2.0",
+		DeviceModel: "linux",
+		DeviceType:  "headless",
+		Fingerprint: "abcdef",
+		Port:        53317,
+		Protocol:    "https",
+		Download:    true,
+	}
+
+	decoded, err := messageFromTXT(messageToTXT(message))
+	if err != nil {
+		t.Fatalf("messageFromTXT: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, message) {
+		t.Fatalf("decoded %+v, want %+v", decoded, message)
+	}
+}
+
+func TestMessageFromTXTRequiresAliasAndType(t *testing.T) {
+	for _, records := range [][]string{
+		{"alias=Phone"},
+		{"deviceType=mobile"},
+		{"alias=", "deviceType=mobile"},
+		nil,
+	} {
+		if _, err := messageFromTXT(records); err == nil {
+			t.Errorf("messageFromTXT(%q) accepted an incomplete message", records)
+		}
+	}
+}
+
+func TestInstanceName(t *testing.T) {
+	message := models.BroadcastMessage{Alias: "Happy Phoenix", Fingerprint: "0123456789abcdef"}
+	if got := instanceName(message); got != "Happy Phoenix (01234567)" {
+		t.Errorf("instanceName = %q", got)
+	}
+
+	message.Alias = strings.Repeat("é", 40)
+	got := instanceName(message)
+	if len(got) > 63 || !utf8.ValidString(got) || !strings.HasSuffix(got, " (01234567)") {
+		t.Errorf("instanceName = %q (%d bytes)", got, len(got))
+	}
+}
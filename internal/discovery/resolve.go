@@ -0,0 +1,92 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+const resolvePollInterval = 500 * time.Millisecond
+
+// ResolvePeer returns the device record of target, which is an IP address
+// (IPv6 with an optional zone), an ip:port pair or the alias of a discovered
+// device. Discovery must already be running; aliases are looked up in
+// shared.DiscoveredDevices until timeout.
+func ResolvePeer(target string, timeout time.Duration) (models.SendModel, error) {
+	if host, port, err := net.SplitHostPort(target); err == nil {
+		if ip, err := netip.ParseAddr(host); err == nil {
+			port, err := strconv.Atoi(port)
+			if err != nil {
+				return models.SendModel{}, fmt.Errorf("invalid port in %q", target)
+			}
+			return lookupOrProbe(ip.Unmap().String(), port), nil
+		}
+	}
+	host := target
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return lookupOrProbe(ip.Unmap().String(), 0), nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var matches []string
+		shared.DevicesMutex.RLock()
+		for ip, device := range shared.DiscoveredDevices {
+			if strings.EqualFold(device.Alias, target) {
+				matches = append(matches, ip)
+			}
+		}
+		shared.DevicesMutex.RUnlock()
+
+		switch {
+		case len(matches) == 1:
+			return shared.LookupDevice(matches[0]), nil
+		case len(matches) > 1:
+			sort.Strings(matches)
+			return models.SendModel{}, fmt.Errorf("alias %q matches several devices: %s", target, strings.Join(matches, ", "))
+		case time.Now().After(deadline):
+			return models.SendModel{}, fmt.Errorf("no device named %q found", target)
+		}
+		time.Sleep(resolvePollInterval)
+	}
+}
+
+// lookupOrProbe returns the registry entry of ip, using port instead of the
+// known one if it is not 0. Devices not discovered yet are asked for their
+// info, which also tells whether they speak HTTPS or plain HTTP.
+func lookupOrProbe(ip string, port int) models.SendModel {
+	shared.DevicesMutex.RLock()
+	_, known := shared.DiscoveredDevices[ip]
+	shared.DevicesMutex.RUnlock()
+
+	device := shared.LookupDevice(ip)
+	if port != 0 {
+		device.Port = port
+	}
+	if known {
+		return device
+	}
+
+	info, err := probeHost(device)
+	if err != nil {
+		return device // Callers report the device being unreachable
+	}
+	// Keep the port that was probed, the advertised one may be unreachable
+	device.Protocol = info.Protocol
+	device.DeviceName = info.Alias
+	device.DeviceType = info.DeviceType
+	device.DeviceModel = info.DeviceModel
+	device.Fingerprint = info.Fingerprint
+	device.LastSeen = info.LastSeen
+	return device
+}
@@ -1,11 +1,14 @@
 package shared
 
 import (
+	"net/netip"
 	"sync"
+	"time"
 
 	"github.com/meowrain/localsend-go/internal/config"
 	"github.com/meowrain/localsend-go/internal/models"
 	"github.com/meowrain/localsend-go/internal/utils"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
 )
 
 // Global device registry, mutex, and broadcast message
@@ -15,21 +18,175 @@ var (
 	DevicesMutex      sync.RWMutex
 )
 
+// Update listeners notified whenever the device registry changes outside of
+// the discovery loops (e.g. a peer registering itself via HTTP)
+var (
+	updateListeners []chan<- []models.SendModel
+	listenersMutex  sync.Mutex
+)
+
 // https://github.com/localsend/protocol?tab=readme-ov-file#71-device-type
 var Message models.BroadcastMessage
 
-// InitMessage populates Message from the loaded config. Must be called after
-// config.LoadConfig().
-func InitMessage() {
+// InitMessage populates Message from the loaded config and the device
+// fingerprint. Must be called after config.LoadConfig().
+func InitMessage(fingerprint string) {
 	Message = models.BroadcastMessage{
 		Alias:       config.ConfigData.NameOfDevice,
 		Version:     "2.0",
 		DeviceModel: utils.CheckOSType(),
-		DeviceType:  "headless",      // CLI tool uses headless type
-		Fingerprint: "random-string", // Should generate a unique fingerprint
-		Port:        53317,
-		Protocol:    "http",
+		DeviceType:  "headless", // CLI tool uses headless type
+		Fingerprint: fingerprint,
+		Port:        config.ConfigData.Port,
+		Protocol:    config.ConfigData.Protocol,
 		Download:    true,
 		Announce:    true,
 	}
 }
+
+// LocalInfo returns our own device info as sent in HTTP requests and responses
+func LocalInfo() models.Info {
+	return models.Info{
+		Alias:       Message.Alias,
+		Version:     Message.Version,
+		DeviceModel: Message.DeviceModel,
+		DeviceType:  Message.DeviceType,
+		Fingerprint: Message.Fingerprint,
+		Port:        Message.Port,
+		Protocol:    Message.Protocol,
+		Download:    Message.Download,
+	}
+}
+
+// IsSelf reports whether fingerprint is our own, i.e. a message or response
+// came from this very node
+func IsSelf(fingerprint string) bool {
+	return fingerprint != "" && fingerprint == Message.Fingerprint
+}
+
+// IsIPv6 reports whether ip, which may carry a zone, is an IPv6 address
+func IsIPv6(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && !addr.Unmap().Is4()
+}
+
+// AddDevice records a device seen at ip. Our own announcements are ignored so
+// this node never lists itself; AddDevice reports whether the device was
+// recorded.
+func AddDevice(ip string, device models.BroadcastMessage) bool {
+	if IsSelf(device.Fingerprint) {
+		return false
+	}
+
+	DevicesMutex.Lock()
+	// A dual-stack device is listed once, under its IPv4 address
+	if device.Fingerprint != "" {
+		for otherIP, other := range DiscoveredDevices {
+			if otherIP == ip || other.Fingerprint != device.Fingerprint || IsIPv6(otherIP) == IsIPv6(ip) {
+				continue
+			}
+			if IsIPv6(ip) {
+				other.LastSeen = device.LastSeen
+				DiscoveredDevices[otherIP] = other
+				DevicesMutex.Unlock()
+				return true
+			}
+			delete(DiscoveredDevices, otherIP)
+		}
+	}
+	if existing, ok := DiscoveredDevices[ip]; ok {
+		// Static peers stay marked as such when they are also discovered
+		device.Static = device.Static || existing.Static
+		// Only multicast tells which interface a device was seen on
+		if device.Interface == "" {
+			device.Interface = existing.Interface
+		}
+	}
+	DiscoveredDevices[ip] = device
+	DevicesMutex.Unlock()
+	return true
+}
+
+// RemoveStale removes devices not seen for longer than ttl and returns their IPs
+func RemoveStale(ttl time.Duration) []string {
+	DevicesMutex.Lock()
+	defer DevicesMutex.Unlock()
+
+	var removed []string
+	for ip, device := range DiscoveredDevices {
+		if time.Since(device.LastSeen) > ttl {
+			delete(DiscoveredDevices, ip)
+			removed = append(removed, ip)
+		}
+	}
+	return removed
+}
+
+// DeviceList returns a snapshot of the discovered devices. Callers must not
+// hold DevicesMutex.
+func DeviceList() []models.SendModel {
+	DevicesMutex.RLock()
+	defer DevicesMutex.RUnlock()
+
+	devices := make([]models.SendModel, 0, len(DiscoveredDevices))
+	for ip, device := range DiscoveredDevices {
+		devices = append(devices, toSendModel(ip, device))
+	}
+	return devices
+}
+
+// LookupDevice returns the registry entry for ip as a SendModel. Unknown
+// devices get the default port and protocol.
+func LookupDevice(ip string) models.SendModel {
+	DevicesMutex.RLock()
+	device, ok := DiscoveredDevices[ip]
+	DevicesMutex.RUnlock()
+
+	if !ok {
+		return models.SendModel{IP: ip, Port: models.DefaultPort, Protocol: "https"}
+	}
+	return toSendModel(ip, device)
+}
+
+// toSendModel converts a registry entry to the model used by senders
+func toSendModel(ip string, device models.BroadcastMessage) models.SendModel {
+	return models.SendModel{
+		IP:          ip,
+		DeviceName:  device.Alias,
+		DeviceType:  device.DeviceType,
+		DeviceModel: device.DeviceModel,
+		Port:        device.Port,
+		Protocol:    device.Protocol,
+		Fingerprint: device.Fingerprint,
+		LastSeen:    device.LastSeen,
+		Static:      device.Static,
+		Interface:   device.Interface,
+	}
+}
+
+// AddUpdateListener registers a channel that receives the device list each
+// time NotifyUpdate is called
+func AddUpdateListener(updates chan<- []models.SendModel) {
+	if updates == nil {
+		return
+	}
+	listenersMutex.Lock()
+	defer listenersMutex.Unlock()
+	updateListeners = append(updateListeners, updates)
+}
+
+// NotifyUpdate pushes the current device list to all registered listeners
+// without blocking
+func NotifyUpdate() {
+	devices := DeviceList()
+
+	listenersMutex.Lock()
+	defer listenersMutex.Unlock()
+	for _, updates := range updateListeners {
+		select {
+		case updates <- devices:
+		default:
+			logger.Debug("Updates channel is full, skipping update")
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package shared
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// TestNodeNeverListsItself feeds our own announcement and a peer's into the
+// registry and checks that only the peer is listed
+func TestNodeNeverListsItself(t *testing.T) {
+	InitMessage("self-fingerprint")
+	t.Cleanup(func() {
+		DevicesMutex.Lock()
+		DiscoveredDevices = make(map[string]models.BroadcastMessage)
+		DevicesMutex.Unlock()
+	})
+
+	self := Message
+	self.LastSeen = time.Now()
+	if AddDevice("192.168.1.10", self) {
+		t.Fatal("AddDevice recorded our own announcement")
+	}
+
+	peer := models.BroadcastMessage{Alias: "Peer", DeviceType: "desktop", Fingerprint: "peer-fingerprint", LastSeen: time.Now()}
+	if !AddDevice("192.168.1.11", peer) {
+		t.Fatal("AddDevice ignored a peer")
+	}
+
+	devices := DeviceList()
+	if len(devices) != 1 || devices[0].Fingerprint != "peer-fingerprint" {
+		t.Fatalf("unexpected device list: %+v", devices)
+	}
+}
+
+func TestRemoveStale(t *testing.T) {
+	InitMessage("self-fingerprint")
+	t.Cleanup(func() {
+		DevicesMutex.Lock()
+		DiscoveredDevices = make(map[string]models.BroadcastMessage)
+		DevicesMutex.Unlock()
+	})
+
+	AddDevice("192.168.1.11", models.BroadcastMessage{Alias: "Fresh", Fingerprint: "fresh", LastSeen: time.Now()})
+	AddDevice("192.168.1.12", models.BroadcastMessage{Alias: "Stale", Fingerprint: "stale", LastSeen: time.Now().Add(-time.Hour)})
+
+	removed := RemoveStale(time.Minute)
+	if len(removed) != 1 || removed[0] != "192.168.1.12" {
+		t.Fatalf("RemoveStale removed %v, want [192.168.1.12]", removed)
+	}
+	if devices := DeviceList(); len(devices) != 1 || devices[0].DeviceName != "Fresh" {
+		t.Fatalf("unexpected device list: %+v", devices)
+	}
+}
+
+func TestDualStackDeviceListedOnce(t *testing.T) {
+	InitMessage("self-fingerprint")
+	t.Cleanup(func() {
+		DevicesMutex.Lock()
+		DiscoveredDevices = make(map[string]models.BroadcastMessage)
+		DevicesMutex.Unlock()
+	})
+
+	peer := models.BroadcastMessage{Alias: "Peer", Fingerprint: "peer", LastSeen: time.Now()}
+	AddDevice("::1", peer)
+	AddDevice("192.168.1.11", peer)
+	AddDevice("fe80::1%eth0", peer)
+
+	devices := DeviceList()
+	if len(devices) != 1 || devices[0].IP != "192.168.1.11" {
+		t.Fatalf("unexpected device list: %+v", devices)
+	}
+}
+
+func TestIsIPv6(t *testing.T) {
+	tests := map[string]bool{
+		"::1":              true,
+		"fe80::1%eth0":     true,
+		"fd00::2":          true,
+		"192.168.1.2":      false,
+		"::ffff:192.0.2.1": false,
+		"not-an-ip":        false,
+	}
+	for ip, want := range tests {
+		if got := IsIPv6(ip); got != want {
+			t.Errorf("IsIPv6(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
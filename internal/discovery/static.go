@@ -0,0 +1,91 @@
+package discovery
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+const peerPollInterval = 10 * time.Second // How often static peers are polled
+
+// parsePeerHost splits a "host[:port]" peer address. Bare IPv6 addresses are
+// accepted with or without brackets.
+func parsePeerHost(address string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		// No port given
+		return strings.Trim(address, "[]"), models.DefaultPort, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, &net.AddrError{Err: "invalid port", Addr: address}
+	}
+	return host, port, nil
+}
+
+// pollPeer asks a static peer for its info and adds it to the discovered
+// devices. A peer whose fingerprint doesn't match the configured one is
+// ignored.
+func pollPeer(peer config.Peer) bool {
+	host, port, err := parsePeerHost(peer.Host)
+	if err != nil {
+		logger.Errorf("Invalid static peer %q: %v", peer.Host, err)
+		return false
+	}
+	ips, err := net.LookupHost(host)
+	if err != nil || len(ips) == 0 {
+		logger.Debugf("Failed to resolve static peer %s: %v", host, err)
+		return false
+	}
+
+	device := shared.LookupDevice(ips[0])
+	device.Port = port
+	info, err := probeHost(device)
+	if err != nil {
+		logger.Debugf("Static peer %s is not reachable: %v", peer.Host, err)
+		return false
+	}
+	if peer.Fingerprint != "" && !strings.EqualFold(info.Fingerprint, peer.Fingerprint) {
+		logger.Warnf("Static peer %s has fingerprint %s, expected %s; ignoring it", peer.Host, info.Fingerprint, peer.Fingerprint)
+		return false
+	}
+
+	// The configured port is the one that reaches the peer, which differs
+	// from the advertised one behind port forwarding
+	info.Port = port
+	info.Static = true
+	if !shared.AddDevice(device.IP, *info) {
+		return false
+	}
+	// Let the peer know about us too
+	go registerWith(shared.LookupDevice(device.IP))
+	return true
+}
+
+// pollStaticPeers keeps the configured static peers in the device list
+func pollStaticPeers() {
+	peers := config.ConfigData.Peers
+	logger.Infof("Polling %d static peer(s)", len(peers))
+
+	ticker := time.NewTicker(peerPollInterval)
+	defer ticker.Stop()
+
+	for {
+		changed := false
+		for _, peer := range peers {
+			if pollPeer(peer) {
+				changed = true
+			}
+		}
+		if changed {
+			shared.NotifyUpdate()
+		}
+		<-ticker.C
+	}
+}
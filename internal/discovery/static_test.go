@@ -0,0 +1,91 @@
+package discovery
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestParsePeerHost(t *testing.T) {
+	tests := []struct {
+		address string
+		host    string
+		port    int
+		wantErr bool
+	}{
+		{"10.8.0.5", "10.8.0.5", models.DefaultPort, false},
+		{"10.8.0.5:1234", "10.8.0.5", 1234, false},
+		{"nas.lan", "nas.lan", models.DefaultPort, false},
+		{"nas.lan:8080", "nas.lan", 8080, false},
+		{"fd00::5", "fd00::5", models.DefaultPort, false},
+		{"[fd00::5]", "fd00::5", models.DefaultPort, false},
+		{"[fd00::5]:1234", "fd00::5", 1234, false},
+		{"10.8.0.5:0", "", 0, true},
+		{"10.8.0.5:http", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		host, port, err := parsePeerHost(tt.address)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePeerHost(%q) error = %v, wantErr %v", tt.address, err, tt.wantErr)
+			continue
+		}
+		if host != tt.host || port != tt.port {
+			t.Errorf("parsePeerHost(%q) = %q, %d; want %q, %d", tt.address, host, port, tt.host, tt.port)
+		}
+	}
+}
+
+// TestPollPeerKeepsConfiguredPort checks that a peer reached through a
+// forwarded port is stored with that port and the protocol that worked, not
+// the ones it advertises
+func TestPollPeerKeepsConfiguredPort(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(models.BroadcastMessage{
+			Alias:       "Forwarded",
+			Fingerprint: "forwarded-peer",
+			Port:        models.DefaultPort,
+			Protocol:    "https",
+		})
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	t.Cleanup(func() {
+		shared.DevicesMutex.Lock()
+		delete(shared.DiscoveredDevices, "127.0.0.1")
+		shared.DevicesMutex.Unlock()
+	})
+
+	if !pollPeer(config.Peer{Host: "127.0.0.1:" + strconv.Itoa(port)}) {
+		t.Fatal("pollPeer did not add the peer")
+	}
+	device := shared.LookupDevice("127.0.0.1")
+	if device.Port != port || device.Protocol != "http" || !device.Static {
+		t.Fatalf("peer stored as %s port %d static %v, want http port %d static", device.Protocol, device.Port, device.Static, port)
+	}
+}
+
+// TestResolvePeerProbesUnknownIP checks that a peer given by IP that discovery
+// hasn't found yet is probed, so a plain HTTP peer isn't addressed over HTTPS
+func TestResolvePeerProbesUnknownIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(models.BroadcastMessage{Alias: "Plain", Fingerprint: "plain-peer", Protocol: "http"})
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	device, err := ResolvePeer("127.0.0.1:"+strconv.Itoa(port), 0)
+	if err != nil {
+		t.Fatalf("ResolvePeer: %v", err)
+	}
+	if device.Protocol != "http" || device.Port != port || device.DeviceName != "Plain" {
+		t.Fatalf("ResolvePeer = %s port %d %q, want http port %d %q", device.Protocol, device.Port, device.DeviceName, port, "Plain")
+	}
+}
@@ -0,0 +1,57 @@
+package discovery
+
+import (
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// Transport is one way of announcing this device and finding peers. Run
+// blocks; the devices it finds are recorded in shared.DiscoveredDevices and
+// pushed to updates.
+type Transport interface {
+	Name() string
+	Run(updates chan<- []models.SendModel) error
+}
+
+// multicastTransport announces and listens on the LocalSend multicast group
+type multicastTransport struct{}
+
+func (multicastTransport) Name() string { return "multicast" }
+
+func (multicastTransport) Run(updates chan<- []models.SendModel) error {
+	go StartUDPBroadcast()
+	ListenForUDPBroadcasts(updates)
+	return nil
+}
+
+// httpScanTransport probes the local subnets over HTTP
+type httpScanTransport struct{}
+
+func (httpScanTransport) Name() string { return "HTTP scan" }
+
+func (httpScanTransport) Run(updates chan<- []models.SendModel) error {
+	ListenForHttpBroadCast(updates)
+	return nil
+}
+
+// staticTransport polls the peers listed in the config
+type staticTransport struct{}
+
+func (staticTransport) Name() string { return "static peers" }
+
+func (staticTransport) Run(updates chan<- []models.SendModel) error {
+	pollStaticPeers()
+	return nil
+}
+
+// transports returns the discovery transports enabled in the config
+func transports() []Transport {
+	enabled := []Transport{multicastTransport{}, httpScanTransport{}}
+	if len(config.ConfigData.Peers) > 0 {
+		enabled = append(enabled, staticTransport{})
+	}
+	if config.ConfigData.MDNS {
+		enabled = append(enabled, mdnsTransport{})
+	}
+	return enabled
+}
@@ -4,73 +4,219 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
+	"github.com/meowrain/localsend-go/internal/config"
 	"github.com/meowrain/localsend-go/internal/discovery/shared"
 	"github.com/meowrain/localsend-go/internal/models"
 	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
-func ListenForUDPBroadcasts(updates chan<- []models.SendModel) {
-	multicastAddr := &net.UDPAddr{
-		IP:   net.ParseIP(multicastIP),
-		Port: broadcastPort,
+// Time between two replies to the same peer, so a peer announcing in a burst
+// only gets one answer
+const replyInterval = time.Second
+
+// Delays between the announcements sent at startup
+var announceBurst = []time.Duration{0, 100 * time.Millisecond, 400 * time.Millisecond}
+
+var (
+	lastReplies  = make(map[string]time.Time) // Last announcement reply by IP
+	repliesMutex sync.Mutex
+)
+
+// multicastGroup returns the discovery multicast group of the IPv4 or the
+// IPv6 family. The link-local IPv6 group is scoped to iface.
+func multicastGroup(v6 bool, iface *net.Interface) *net.UDPAddr {
+	if !v6 {
+		return &net.UDPAddr{IP: net.ParseIP(multicastIP), Port: config.ConfigData.MulticastPort}
+	}
+	addr := &net.UDPAddr{IP: net.ParseIP(multicastIPv6), Port: config.ConfigData.MulticastPort}
+	if iface != nil {
+		addr.Zone = iface.Name
+	}
+	return addr
+}
+
+// packetInfo tells where a datagram arrived
+type packetInfo struct {
+	ifIndex int    // Index of the receiving interface, 0 if unknown
+	dst     net.IP // Destination address, nil if unknown
+}
+
+// multicastListener reads datagrams sent to the multicast port along with
+// where they arrived
+type multicastListener interface {
+	ReadFrom(b []byte) (int, packetInfo, net.Addr, error)
+	Close() error
+}
+
+type ipv4Listener struct{ *ipv4.PacketConn }
+
+func (l ipv4Listener) ReadFrom(b []byte) (int, packetInfo, net.Addr, error) {
+	n, cm, src, err := l.PacketConn.ReadFrom(b)
+	if cm == nil {
+		return n, packetInfo{}, src, err
+	}
+	return n, packetInfo{ifIndex: cm.IfIndex, dst: cm.Dst}, src, err
+}
+
+type ipv6Listener struct{ *ipv6.PacketConn }
+
+func (l ipv6Listener) ReadFrom(b []byte) (int, packetInfo, net.Addr, error) {
+	n, cm, src, err := l.PacketConn.ReadFrom(b)
+	if cm == nil {
+		return n, packetInfo{}, src, err
+	}
+	return n, packetInfo{ifIndex: cm.IfIndex, dst: cm.Dst}, src, err
+}
+
+// listenMulticast opens one socket that joins the multicast group of the
+// given family on each of ifaces. An IPv4 socket joins on the system default
+// interface if ifaces is empty.
+func listenMulticast(v6 bool, ifaces []net.Interface) (multicastListener, error) {
+	var first *net.Interface
+	if len(ifaces) > 0 {
+		first = &ifaces[0]
 	}
 
-	conn, err := net.ListenMulticastUDP("udp", nil, multicastAddr)
+	network := "udp4"
+	if v6 {
+		network = "udp6"
+	}
+	conn, err := net.ListenMulticastUDP(network, first, multicastGroup(v6, nil))
 	if err != nil {
-		logger.Errorf("Failed to listen for UDP broadcasts: %v", err)
-		return
+		return nil, err
 	}
-	defer conn.Close()
 
-	conn.SetReadBuffer(4096)
+	if v6 {
+		pc := ipv6.NewPacketConn(conn)
+		for i := 1; i < len(ifaces); i++ {
+			if err := pc.JoinGroup(&ifaces[i], multicastGroup(true, nil)); err != nil {
+				logger.Errorf("Failed to join IPv6 multicast group on %s: %v", ifaces[i].Name, err)
+			}
+		}
+		if err := pc.SetControlMessage(ipv6.FlagInterface|ipv6.FlagDst, true); err != nil {
+			logger.Debugf("Interface of incoming multicast packets is not available: %v", err)
+		}
+		return ipv6Listener{pc}, nil
+	}
+
+	pc := ipv4.NewPacketConn(conn)
+	for i := 1; i < len(ifaces); i++ {
+		if err := pc.JoinGroup(&ifaces[i], multicastGroup(false, nil)); err != nil {
+			logger.Errorf("Failed to join multicast group on %s: %v", ifaces[i].Name, err)
+		}
+	}
+	if err := pc.SetControlMessage(ipv4.FlagInterface|ipv4.FlagDst, true); err != nil {
+		logger.Debugf("Interface of incoming multicast packets is not available: %v", err)
+	}
+	return ipv4Listener{pc}, nil
+}
+
+// ListenForUDPBroadcasts listens for announcements on the IPv4 multicast
+// group and, on interfaces with an IPv6 address, on the IPv6 group. The IPv4
+// socket is bound to the wildcard address, so it also receives the directed
+// broadcasts of the broadcast fallback.
+func ListenForUDPBroadcasts(updates chan<- []models.SendModel) {
+	ifaces := multicastInterfaces()
+	families := []bool{false}
+	if len(withFamily(ifaces, true)) > 0 {
+		families = append(families, true)
+	}
+
+	var wg sync.WaitGroup
+	for _, v6 := range families {
+		selected := withFamily(ifaces, v6)
+		conn, err := listenMulticast(v6, selected)
+		if err != nil {
+			logger.Errorf("Failed to listen for UDP broadcasts on %s: %v", multicastGroup(v6, nil), err)
+			continue
+		}
+
+		names := make([]string, 0, len(selected))
+		for _, iface := range selected {
+			names = append(names, iface.Name)
+		}
+		logger.Infof("Started listening for UDP broadcasts on %s %v", multicastGroup(v6, nil), names)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			serveMulticast(conn, updates)
+		}()
+	}
+	wg.Wait()
+}
+
+// parseAnnouncement decodes and validates an announcement datagram
+func parseAnnouncement(data []byte) (models.BroadcastMessage, error) {
+	var message models.BroadcastMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return message, fmt.Errorf("failed to unmarshal broadcast message: %w", err)
+	}
 
-	logger.Info("Started listening for UDP broadcasts on ", multicastAddr.String())
+	// Validate required fields
+	if message.Alias == "" || message.DeviceType == "" {
+		return message, fmt.Errorf("invalid broadcast message: missing required fields")
+	}
+	return message, nil
+}
 
+// serveMulticast adds the devices announcing themselves on conn
+func serveMulticast(conn multicastListener, updates chan<- []models.SendModel) {
 	for {
 		buf := make([]byte, 4096)
-		n, remoteAddr, err := conn.ReadFromUDP(buf)
+		n, info, src, err := conn.ReadFrom(buf)
 		if err != nil {
 			logger.Errorf("Error reading UDP broadcast: %v", err)
 			continue
 		}
+		remoteAddr, ok := src.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		// Keep the zone of link-local IPv6 addresses
+		ip := (&net.IPAddr{IP: remoteAddr.IP, Zone: remoteAddr.Zone}).String()
 
 		logger.Debugf("Received UDP broadcast from %s, size: %d bytes", remoteAddr.String(), n)
 
 		// Print raw message content for debugging
 		logger.Debugf("Raw message: %s", string(buf[:n]))
 
-		var message models.BroadcastMessage
-		if err = json.Unmarshal(buf[:n], &message); err != nil {
-			logger.Errorf("Failed to unmarshal broadcast message from %s: %v", remoteAddr.IP.String(), err)
-			continue
-		}
-
-		// Validate required fields
-		if message.Alias == "" || message.DeviceType == "" {
-			logger.Errorf("Invalid broadcast message from %s: missing required fields", remoteAddr.IP.String())
+		message, err := parseAnnouncement(buf[:n])
+		if err != nil {
+			logger.Errorf("Ignoring UDP broadcast from %s: %v", ip, err)
 			continue
 		}
 
 		message.LastSeen = time.Now()
+		message.Interface = interfaceName(info.ifIndex)
 
-		logger.Debugf("Parsed message from %s: %+v", remoteAddr.IP.String(), message)
-
-		shared.DevicesMutex.Lock()
-		shared.DiscoveredDevices[remoteAddr.IP.String()] = message
+		logger.Debugf("Parsed message from %s: %+v", ip, message)
 
-		devices := make([]models.SendModel, 0, len(shared.DiscoveredDevices))
-		for ip, device := range shared.DiscoveredDevices {
-			devices = append(devices, models.SendModel{
-				IP:         ip,
-				DeviceName: device.Alias,
-			})
+		// Skip the loopback copies of our own announcements
+		if !shared.AddDevice(ip, message) {
+			continue
 		}
-		shared.DevicesMutex.Unlock()
+		// Directed broadcasts don't prove that multicast works
+		if info.dst == nil || info.dst.IsMulticast() {
+			lastMulticast.Store(time.Now().UnixNano())
+		}
+
+		devices := shared.DeviceList()
 
 		logger.Debugf("Updated devices list: %+v", devices)
 
+		// Answer announcements so the peer finds us without waiting for our
+		// next broadcast
+		if message.Announce {
+			go replyToAnnouncement(ip)
+		}
+
 		select {
 		case updates <- devices:
 			logger.Debug("Successfully sent device updates")
@@ -80,20 +226,177 @@ func ListenForUDPBroadcasts(updates chan<- []models.SendModel) {
 	}
 }
 
-func StartUDPBroadcast() {
-	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", multicastIP, broadcastPort))
-	if err != nil {
-		logger.Errorf("Failed to resolve UDP address: %v", err)
+// replyToAnnouncement answers a peer that announced itself, by registering
+// with it over HTTP or, if that fails, with a multicast message that does not
+// ask for an answer. The message is broadcast as well while the broadcast
+// fallback is active.
+func replyToAnnouncement(ip string) {
+	repliesMutex.Lock()
+	if time.Since(lastReplies[ip]) < replyInterval {
+		repliesMutex.Unlock()
 		return
 	}
+	lastReplies[ip] = time.Now()
+	repliesMutex.Unlock()
 
-	conn, err := net.DialUDP("udp", nil, addr)
-	if err != nil {
-		logger.Errorf("Failed to dial UDP: %v", err)
+	device := shared.LookupDevice(ip)
+	_, err := registerWith(device)
+	if err == nil {
+		logger.Debugf("Replied to announcement from %s via HTTP", ip)
 		return
 	}
+	logger.Debugf("Failed to register with %s, replying via multicast: %v", ip, err)
+
+	// Reply on the interface the announcement arrived on
+	var iface *net.Interface
+	if device.Interface != "" {
+		iface, _ = net.InterfaceByName(device.Interface)
+	}
+
+	message := shared.Message
+	message.Announce = false
+	data, err := json.Marshal(message)
+	if err == nil {
+		err = sendMulticast(shared.IsIPv6(ip), iface, data)
+	}
+	if err != nil {
+		logger.Errorf("Failed to reply to announcement from %s: %v", ip, err)
+	}
+	if broadcastFallback() && !shared.IsIPv6(ip) {
+		if err := sendBroadcasts(data); err != nil {
+			logger.Debugf("Failed to reply to announcement from %s via broadcast: %v", ip, err)
+		}
+	}
+}
+
+// sendBroadcasts sends a datagram to the directed broadcast address of each
+// IPv4 discovery interface, on the multicast port
+func sendBroadcasts(data []byte) error {
+	addrs := broadcastAddrs(withFamily(multicastInterfaces(), false))
+	if len(addrs) == 0 {
+		return fmt.Errorf("no interface with a broadcast address")
+	}
+
+	// Go enables SO_BROADCAST on UDP sockets
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
 
+	var sendErr error
+	for _, addr := range addrs {
+		dst := &net.UDPAddr{IP: addr, Port: config.ConfigData.MulticastPort}
+		if _, err := conn.WriteTo(data, dst); err != nil {
+			sendErr = fmt.Errorf("failed to send to %s: %w", dst, err)
+		}
+	}
+	return sendErr
+}
+
+// multicastSender sends to the multicast group out of a single interface
+type multicastSender struct {
+	v6    bool
+	iface *net.Interface // nil for the system default interface
+	conn  net.PacketConn
+}
+
+func newMulticastSender(v6 bool, iface *net.Interface) (*multicastSender, error) {
+	network, address := "udp4", "0.0.0.0:0"
+	if v6 {
+		network, address = "udp6", "[::]:0"
+	}
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if iface != nil {
+		if v6 {
+			err = ipv6.NewPacketConn(conn).SetMulticastInterface(iface)
+		} else {
+			err = ipv4.NewPacketConn(conn).SetMulticastInterface(iface)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return &multicastSender{v6: v6, iface: iface, conn: conn}, nil
+}
+
+// Send writes one datagram to the multicast group
+func (s *multicastSender) Send(data []byte) error {
+	_, err := s.conn.WriteTo(data, multicastGroup(s.v6, s.iface))
+	return err
+}
+
+// Name describes the sender's interface and family, e.g. "eth0/IPv6"
+func (s *multicastSender) Name() string {
+	name := "default"
+	if s.iface != nil {
+		name = s.iface.Name
+	}
+	if s.v6 {
+		return name + "/IPv6"
+	}
+	return name + "/IPv4"
+}
+
+func (s *multicastSender) Close() error {
+	return s.conn.Close()
+}
+
+// sendMulticast sends a single datagram to the multicast group of the given
+// family on iface, or on the system default interface if iface is nil
+func sendMulticast(v6 bool, iface *net.Interface, data []byte) error {
+	sender, err := newMulticastSender(v6, iface)
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+	return sender.Send(data)
+}
+
+// openSenders opens a multicast sender for each discovery interface and
+// address family. IPv4 falls back to the system default interface; IPv6 is
+// only used on interfaces that have an IPv6 address.
+func openSenders() []*multicastSender {
+	ifaces := multicastInterfaces()
+	senders := make([]*multicastSender, 0, 2*len(ifaces))
+
+	if len(withFamily(ifaces, false)) == 0 {
+		if sender, err := newMulticastSender(false, nil); err != nil {
+			logger.Errorf("Failed to open UDP broadcast socket: %v", err)
+		} else {
+			senders = append(senders, sender)
+		}
+	}
+	for _, v6 := range []bool{false, true} {
+		selected := withFamily(ifaces, v6)
+		for i := range selected {
+			sender, err := newMulticastSender(v6, &selected[i])
+			if err != nil {
+				logger.Errorf("Failed to open UDP broadcast socket on %s: %v", selected[i].Name, err)
+				continue
+			}
+			senders = append(senders, sender)
+		}
+	}
+	return senders
+}
+
+func StartUDPBroadcast() {
+	senders := openSenders()
+	if len(senders) == 0 {
+		logger.Error("No interface to send UDP broadcasts on")
+		return
+	}
+	defer func() {
+		for _, sender := range senders {
+			sender.Close()
+		}
+	}()
+
 	logger.Info("Started UDP broadcast")
 
 	ticker := time.NewTicker(2 * time.Second)
@@ -101,42 +404,77 @@ func StartUDPBroadcast() {
 
 	const maxFailCount = 3 // Maximum consecutive failures
 	failCount := 0         // Failure counter
+	broadcasting := false  // Whether the broadcast fallback is active
 
-	refreshConnection := func() {
-		conn.Close()
-		conn, err = net.DialUDP("udp", nil, addr)
-		if err != nil {
-			logger.Errorf("Failed to refresh UDP connection: %v", err)
-			return
+	refreshConnections := func() {
+		for i, sender := range senders {
+			sender.Close()
+			refreshed, err := newMulticastSender(sender.v6, sender.iface)
+			if err != nil {
+				logger.Errorf("Failed to refresh UDP connection on %s: %v", sender.Name(), err)
+				continue
+			}
+			senders[i] = refreshed
 		}
 	}
 
-	for range ticker.C {
-		data, err := json.Marshal(shared.Message)
+	// send multicasts our device info on every interface. Only the startup
+	// burst asks peers to answer; the periodic keep-alives would otherwise
+	// make every peer reply every few seconds.
+	send := func(announce bool) {
+		message := shared.Message
+		message.Announce = announce
+		data, err := json.Marshal(message)
 		if err != nil {
 			logger.Errorf("Failed to marshal broadcast message: %v", err)
-			failCount++
-			if failCount >= maxFailCount {
-				logger.Info("Refreshing UDP connection due to consecutive failures")
-				refreshConnection()
-				failCount = 0 // Reset failure counter
-			}
-			continue
+			return
 		}
 
-		_, err = conn.Write(data)
-		if err != nil {
-			logger.Errorf("Failed to send UDP broadcast: %v", err)
+		sent := false
+		for _, sender := range senders {
+			if err := sender.Send(data); err != nil {
+				logger.Errorf("Failed to send UDP broadcast on %s: %v", sender.Name(), err)
+				continue
+			}
+			sent = true
+		}
+		if !sent {
 			failCount++
 			if failCount >= maxFailCount {
-				logger.Info("Refreshing UDP connection due to consecutive failures")
-				refreshConnection()
+				logger.Info("Refreshing UDP connections due to consecutive failures")
+				refreshConnections()
 				failCount = 0 // Reset failure counter
 			}
-			continue
+			return
 		}
 
 		logger.Debug("Sent UDP broadcast")
 		failCount = 0 // Reset failure counter after successful send
+
+		// Reach peers behind switches that drop multicast
+		fallback := broadcastFallback()
+		if fallback != broadcasting {
+			broadcasting = fallback
+			if fallback {
+				logger.Infof("No multicast packets within %s, also sending UDP broadcasts", multicastWindow())
+			} else {
+				logger.Info("Multicast is working, stopped sending UDP broadcasts")
+			}
+		}
+		if fallback {
+			if err := sendBroadcasts(data); err != nil {
+				logger.Debugf("Failed to send UDP directed broadcast: %v", err)
+			}
+		}
+	}
+
+	// Announce ourselves a few times right away so peers answer immediately
+	for _, delay := range announceBurst {
+		time.Sleep(delay)
+		send(true)
+	}
+
+	for range ticker.C {
+		send(false)
 	}
 }
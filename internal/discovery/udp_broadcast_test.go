@@ -0,0 +1,25 @@
+package discovery
+
+import "testing"
+
+func TestParseAnnouncement(t *testing.T) {
+	tests := []struct {
+		data    string
+		wantErr bool
+	}{
+		{`{"alias":"Phone","deviceType":"mobile","fingerprint":"abc","announce":true}`, false},
+		{`{"alias":"Phone"}`, true},
+		{`{"deviceType":"mobile"}`, true},
+		{`not json`, true},
+	}
+
+	for _, tt := range tests {
+		message, err := parseAnnouncement([]byte(tt.data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAnnouncement(%s) error = %v, wantErr %v", tt.data, err, tt.wantErr)
+		}
+		if err == nil && (message.Alias != "Phone" || !message.Announce) {
+			t.Errorf("parseAnnouncement(%s) = %+v", tt.data, message)
+		}
+	}
+}
@@ -40,6 +40,13 @@ func HandleCancel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The sender cancelled a session we are receiving
+	if receiveSessions.Cancel(sessionID) {
+		logger.Info("Receive session cancelled by sender: ", sessionID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
 	handlersLock.RLock()
 	cancelFunc, exists := cancelHandlers[sessionID]
 	handlersLock.RUnlock()
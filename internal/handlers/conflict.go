@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/tui"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/meowrain/localsend-go/internal/utils/safepath"
+	"github.com/meowrain/localsend-go/internal/utils/sha256"
+	"golang.org/x/term"
+)
+
+// maxRenames bounds the "name (n).ext" candidates tried for a received file
+const maxRenames = 1000
+
+// resolveConflicts applies the on_conflict policy to the accepted files whose
+// name is already taken in the save directory. It returns the files still to
+// be uploaded and those among them that replace the existing file; the others
+// are saved under a new name.
+func resolveConflicts(accepted []string, files map[string]models.FileInfo) ([]string, []string) {
+	var overwrite []string
+	conflicts := make(map[string]models.FileInfo)
+	paths := make(map[string]string)
+	for _, id := range accepted {
+		path, err := safepath.Join(config.ConfigData.SaveDir, files[id].FileName)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			conflicts[id] = files[id]
+			paths[id] = path
+		}
+	}
+	if len(conflicts) == 0 {
+		return accepted, nil
+	}
+
+	skip := make(map[string]bool)
+	switch config.ConfigData.Receive.OnConflict {
+	case "overwrite":
+		for id := range conflicts {
+			overwrite = append(overwrite, id)
+		}
+	case "skip":
+		for id, file := range conflicts {
+			if file.SHA256 == "" {
+				continue
+			}
+			hash, err := sha256.CalculateSHA256(paths[id])
+			if err != nil {
+				logger.Errorf("Failed to hash %s: %v", paths[id], err)
+				continue
+			}
+			if strings.EqualFold(hash, file.SHA256) {
+				logger.Infof("Skipping %s, an identical file already exists", file.FileName)
+				skip[id] = true
+			}
+		}
+	case "ask":
+		if chosen, ok := askOverwrite(conflicts); ok {
+			for id := range conflicts {
+				if chosen[id] {
+					overwrite = append(overwrite, id)
+				} else {
+					skip[id] = true
+				}
+			}
+		}
+	}
+
+	upload := make([]string, 0, len(accepted))
+	for _, id := range accepted {
+		if !skip[id] {
+			upload = append(upload, id)
+		}
+	}
+	return upload, overwrite
+}
+
+// askOverwrite lets the user pick which of the existing files are overwritten.
+// It reports false when the user couldn't be asked, in which case the files
+// are renamed.
+func askOverwrite(conflicts map[string]models.FileInfo) (map[string]bool, bool) {
+	if !receivePrompt || !term.IsTerminal(int(os.Stdin.Fd())) {
+		logger.Infof("No terminal to ask about %d existing file(s), renaming them", len(conflicts))
+		return nil, false
+	}
+
+	title := fmt.Sprintf("%d file(s) already exist. Select the ones to overwrite, the others are skipped:", len(conflicts))
+	timeout := time.Duration(config.ConfigData.Receive.PromptTimeout) * time.Second
+	ids, timedOut, err := tui.SelectFiles(title, conflicts, timeout)
+	if err != nil {
+		logger.Errorf("Failed to show overwrite prompt: %v", err)
+		return nil, false
+	}
+	if timedOut {
+		logger.Info("No answer before timeout, renaming existing files")
+		return nil, false
+	}
+
+	chosen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		chosen[id] = true
+	}
+	return chosen, true
+}
+
+// placeFile moves the received file at part to path and returns its final
+// path. Unless overwrite is set, an existing file is kept and the received one
+// gets the first free "name (n).ext" name.
+func placeFile(part, path string, overwrite bool) (string, error) {
+	if overwrite {
+		return path, os.Rename(part, path)
+	}
+
+	ext := filepath.Ext(path)
+	if ext == filepath.Base(path) {
+		ext = "" // Dot files like .bashrc have no extension
+	}
+	base := strings.TrimSuffix(path, ext)
+
+	for n := 0; n <= maxRenames; n++ {
+		candidate := path
+		if n > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+		// Linking fails if the name is taken, unlike rename which replaces
+		err := os.Link(part, candidate)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			// Not every filesystem supports hard links (e.g. FAT), so fall
+			// back to checking for the name before renaming
+			if _, statErr := os.Lstat(candidate); statErr == nil {
+				continue
+			}
+			return candidate, os.Rename(part, candidate)
+		}
+		return candidate, os.Remove(part)
+	}
+	return "", fmt.Errorf("no free name for %s", path)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/sha256"
+)
+
+func TestPlaceFileRenames(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"photo.jpg": "old", ".bashrc": "old"})
+
+	for _, tt := range []struct{ name, want string }{
+		{"photo.jpg", "photo (1).jpg"},
+		{"photo.jpg", "photo (2).jpg"},
+		{".bashrc", ".bashrc (1)"},
+		{"new.txt", "new.txt"},
+	} {
+		part := filepath.Join(dir, ".part")
+		writeTree(t, dir, map[string]string{".part": "new"})
+		path, err := placeFile(part, filepath.Join(dir, tt.name), false)
+		if err != nil {
+			t.Fatalf("placeFile(%s): %v", tt.name, err)
+		}
+		if path != filepath.Join(dir, tt.want) {
+			t.Errorf("placeFile(%s) = %s, want %s", tt.name, filepath.Base(path), tt.want)
+		}
+		if _, err := os.Stat(part); !os.IsNotExist(err) {
+			t.Errorf("placeFile(%s) left the part file behind", tt.name)
+		}
+	}
+
+	writeTree(t, dir, map[string]string{".part": "new"})
+	path, err := placeFile(filepath.Join(dir, ".part"), filepath.Join(dir, "photo.jpg"), true)
+	if err != nil || path != filepath.Join(dir, "photo.jpg") {
+		t.Fatalf("placeFile with overwrite = %s, %v", path, err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "new" {
+		t.Errorf("photo.jpg = %q after overwrite", got)
+	}
+}
+
+func TestResolveConflictsSkipsIdenticalFiles(t *testing.T) {
+	dir := t.TempDir()
+	setConfig(t, &config.ConfigData.SaveDir, dir)
+	setConfig(t, &config.ConfigData.Receive.OnConflict, "skip")
+	writeTree(t, dir, map[string]string{"same.txt": "same", "changed.txt": "old"})
+
+	hash, err := sha256.CalculateSHA256(filepath.Join(dir, "same.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]models.FileInfo{
+		"same":    {ID: "same", FileName: "same.txt", SHA256: hash},
+		"changed": {ID: "changed", FileName: "changed.txt", SHA256: hash},
+		"new":     {ID: "new", FileName: "new.txt"},
+	}
+
+	upload, overwrite := resolveConflicts([]string{"same", "changed", "new"}, files)
+	if len(upload) != 2 || upload[0] != "changed" || upload[1] != "new" || len(overwrite) != 0 {
+		t.Fatalf("upload = %v, overwrite = %v", upload, overwrite)
+	}
+}
+
+func TestReceiveKeepsExistingFiles(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	device := newReceiveServer(t, dst)
+	setConfig(t, &config.ConfigData.Receive.OnConflict, "rename")
+	writeTree(t, src, map[string]string{"photo.jpg": "new"})
+	writeTree(t, dst, map[string]string{"photo.jpg": "old"})
+
+	if err := sendToDevice(device, filepath.Join(src, "photo.jpg"), ""); err != nil {
+		t.Fatalf("sendToDevice: %v", err)
+	}
+
+	for name, want := range map[string]string{"photo.jpg": "old", "photo (1).jpg": "new"} {
+		got, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestSendIdenticalFileIsSkipped(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	device := newReceiveServer(t, dst)
+	setConfig(t, &config.ConfigData.Receive.OnConflict, "skip")
+	writeTree(t, src, map[string]string{"photo.jpg": "same"})
+	writeTree(t, dst, map[string]string{"photo.jpg": "same"})
+
+	if err := sendToDevice(device, filepath.Join(src, "photo.jpg"), ""); err != nil {
+		t.Fatalf("sendToDevice: %v", err)
+	}
+
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "photo.jpg" {
+		t.Fatalf("save directory holds %v, want only photo.jpg", entries)
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+var (
+	shareSessionID string
+	sharedFiles    = make(map[string]localFile) // Shared files by ID
+	sharePin       string
+	shareAllowed   = make(map[string]bool) // IPs that passed the PIN check
+	shareMutex     sync.RWMutex
+)
+
+// ShareFiles publishes the given files and directories under a new download
+// session. If pin is not empty, peers must provide it in prepare-download.
+func ShareFiles(paths []string, pin string) (map[string]models.FileInfo, error) {
+	files, err := collectFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files to share")
+	}
+
+	shareMutex.Lock()
+	defer shareMutex.Unlock()
+	shareSessionID = uuid.NewString()
+	sharedFiles = files
+	sharePin = pin
+	shareAllowed = make(map[string]bool)
+
+	return fileInfos(files), nil
+}
+
+// PrepareDownloadHandler returns the shared file list. GET is accepted as
+// well so the list can be opened in a browser.
+func PrepareDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" && r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	shareMutex.RLock()
+	sessionID, pin, files := shareSessionID, sharePin, sharedFiles
+	shareMutex.RUnlock()
+
+	if sessionID == "" {
+		http.Error(w, "Nothing shared", http.StatusForbidden)
+		return
+	}
+	if !checkPin(w, r, pin) {
+		return
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Invalid remote address", http.StatusBadRequest)
+		return
+	}
+	shareMutex.Lock()
+	shareAllowed[ip] = true
+	shareMutex.Unlock()
+
+	resp := models.PrepareDownloadResponse{
+		Info:      shared.LocalInfo(),
+		SessionID: sessionID,
+		Files:     make(map[string]models.FileInfo, len(files)),
+	}
+	for id, file := range files {
+		resp.Files[id] = file.Info
+	}
+
+	logger.Infof("%s requested the shared file list", ip)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// DownloadHandler streams a shared file
+func DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	fileID := r.URL.Query().Get("fileId")
+	if sessionID == "" || fileID == "" {
+		http.Error(w, "Missing parameters", http.StatusBadRequest)
+		return
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Invalid remote address", http.StatusBadRequest)
+		return
+	}
+
+	shareMutex.RLock()
+	file, ok := sharedFiles[fileID]
+	valid := ok && sessionID == shareSessionID && (sharePin == "" || shareAllowed[ip])
+	shareMutex.RUnlock()
+	if !valid {
+		http.Error(w, "Invalid session or file ID", http.StatusForbidden)
+		return
+	}
+
+	f, err := os.Open(file.Path)
+	if err != nil {
+		http.Error(w, "Failed to open file", http.StatusInternalServerError)
+		logger.Errorf("Error opening shared file: %v", err)
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Failed to open file", http.StatusInternalServerError)
+		logger.Errorf("Error opening shared file: %v", err)
+		return
+	}
+
+	logger.Infof("Sending %s to %s", file.Info.FileName, ip)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(file.Path)}))
+	http.ServeContent(w, r, file.Path, stat.ModTime(), f)
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// shareForTest shares the file at path with pin and unshares it when the
+// test ends. It returns the ID of the shared file.
+func shareForTest(t *testing.T, path, pin string) string {
+	t.Helper()
+	resetPinFailures(t)
+	files, err := ShareFiles([]string{path}, pin)
+	if err != nil {
+		t.Fatalf("ShareFiles: %v", err)
+	}
+	t.Cleanup(func() {
+		shareMutex.Lock()
+		shareSessionID, sharePin = "", ""
+		sharedFiles = make(map[string]localFile)
+		shareAllowed = make(map[string]bool)
+		shareMutex.Unlock()
+	})
+	for id := range files {
+		return id
+	}
+	return ""
+}
+
+// serveDownload calls handler for a request from ip and returns the recorder
+func serveDownload(handler http.HandlerFunc, ip, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, nil)
+	req.RemoteAddr = ip + ":40000"
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// downloadURL returns the download request target of a file
+func downloadURL(sessionID, fileID string) string {
+	return "/api/localsend/v2/download?sessionId=" + url.QueryEscape(sessionID) + "&fileId=" + url.QueryEscape(fileID)
+}
+
+func TestPrepareDownloadRequiresPin(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"notes.txt": "shared notes"})
+	fileID := shareForTest(t, filepath.Join(dir, "notes.txt"), "1234")
+
+	if rec := serveDownload(PrepareDownloadHandler, "192.168.1.2", "/api/localsend/v2/prepare-download"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without PIN: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := serveDownload(PrepareDownloadHandler, "192.168.1.2", "/api/localsend/v2/prepare-download?pin=0000"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong PIN: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec := serveDownload(PrepareDownloadHandler, "192.168.1.2", "/api/localsend/v2/prepare-download?pin=1234")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("correct PIN: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var resp models.PrepareDownloadResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Files[fileID].FileName != "notes.txt" {
+		t.Fatalf("file list = %+v", resp.Files)
+	}
+
+	// The PIN check is per IP
+	if rec := serveDownload(DownloadHandler, "192.168.1.3", downloadURL(resp.SessionID, fileID)); rec.Code != http.StatusForbidden {
+		t.Fatalf("IP without PIN: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	rec = serveDownload(DownloadHandler, "192.168.1.2", downloadURL(resp.SessionID, fileID))
+	if rec.Code != http.StatusOK || rec.Body.String() != "shared notes" {
+		t.Fatalf("download: status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDownloadStreamsSharedFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"photo.jpg": "image data"})
+	fileID := shareForTest(t, filepath.Join(dir, "photo.jpg"), "")
+
+	rec := serveDownload(PrepareDownloadHandler, "192.168.1.2", "/api/localsend/v2/prepare-download")
+	var resp models.PrepareDownloadResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("prepare-download: status = %d, %v", rec.Code, err)
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		want     int
+		wantBody string
+	}{
+		{"missing parameters", "/api/localsend/v2/download", http.StatusBadRequest, ""},
+		{"unknown session", downloadURL("other", fileID), http.StatusForbidden, ""},
+		{"unknown file", downloadURL(resp.SessionID, "other"), http.StatusForbidden, ""},
+		{"shared file", downloadURL(resp.SessionID, fileID), http.StatusOK, "image data"},
+	}
+	for _, tt := range tests {
+		rec := serveDownload(DownloadHandler, "192.168.1.2", tt.target)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+			continue
+		}
+		if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+			t.Errorf("%s: body = %q, want %q", tt.name, rec.Body.String(), tt.wantBody)
+		}
+	}
+}
+
+func TestDownloadFileKeepsExistingFile(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	setConfig(t, &config.ConfigData.SaveDir, dst)
+	writeTree(t, src, map[string]string{"photo.jpg": "new"})
+	writeTree(t, dst, map[string]string{"photo.jpg": "old"})
+	shareForTest(t, filepath.Join(src, "photo.jpg"), "")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/localsend/v2/prepare-download", PrepareDownloadHandler)
+	mux.HandleFunc("/api/localsend/v2/download", DownloadHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	device := models.SendModel{IP: "127.0.0.1", Port: server.Listener.Addr().(*net.TCPAddr).Port, Protocol: "http"}
+	resp, err := PrepareDownload(device, "")
+	if err != nil {
+		t.Fatalf("PrepareDownload: %v", err)
+	}
+	for _, file := range resp.Files {
+		if err := downloadFile(device, resp.SessionID, file); err != nil {
+			t.Fatalf("downloadFile: %v", err)
+		}
+	}
+
+	entries, _ := os.ReadDir(dst)
+	if len(entries) != 2 {
+		t.Fatalf("save directory holds %v, want photo.jpg and its copy", entries)
+	}
+	for name, want := range map[string]string{"photo.jpg": "old", "photo (1).jpg": "new"} {
+		got, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/tui"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/meowrain/localsend-go/internal/utils/safepath"
+	"golang.org/x/term"
+)
+
+const resolveTimeout = 10 * time.Second // How long to wait for an alias to be discovered
+
+// PrepareDownload asks the peer for its shared files. If the peer requires a
+// PIN, pin is tried first and the user is then prompted for it.
+func PrepareDownload(device models.SendModel, pin string) (*models.PrepareDownloadResponse, error) {
+	client := &http.Client{
+		Timeout: 60 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, // Skip TLS verification for local network
+			},
+		},
+	}
+
+	var resp *http.Response
+	var err error
+	for prompts := 0; ; prompts++ {
+		prepareURL := device.URL("/api/localsend/v2/prepare-download")
+		if pin != "" {
+			prepareURL += "?pin=" + url.QueryEscape(pin)
+		}
+		resp, err = client.Post(prepareURL, "application/json", nil)
+		if err != nil {
+			return nil, fmt.Errorf("error sending POST request: %w", err)
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			break
+		}
+		resp.Body.Close()
+
+		if prompts >= maxPinPrompts {
+			return nil, fmt.Errorf("invalid PIN")
+		}
+		if pin != "" {
+			fmt.Println("Wrong PIN.")
+		}
+		pin, err = promptPin()
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		switch resp.StatusCode {
+		case 403:
+			return nil, fmt.Errorf("rejected (is the peer sharing files?)")
+		case 404:
+			return nil, fmt.Errorf("peer does not support the download API")
+		case 429:
+			return nil, fmt.Errorf("too many PIN attempts, try again later")
+		}
+		return nil, fmt.Errorf("failed to list files: received status code %d", resp.StatusCode)
+	}
+
+	var prepareDownloadResponse models.PrepareDownloadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&prepareDownloadResponse); err != nil {
+		return nil, fmt.Errorf("error decoding response JSON: %w", err)
+	}
+	return &prepareDownloadResponse, nil
+}
+
+// downloadFile downloads a single file into the save directory and verifies
+// its SHA-256 hash when the peer provided one
+func downloadFile(device models.SendModel, sessionID string, file models.FileInfo) error {
+	filePath, err := safepath.Join(config.ConfigData.SaveDir, file.FileName)
+	if err != nil {
+		return fmt.Errorf("invalid file name %q: %w", file.FileName, err)
+	}
+
+	downloadURL := device.URL(fmt.Sprintf("/api/localsend/v2/download?sessionId=%s&fileId=%s",
+		url.QueryEscape(sessionID), url.QueryEscape(file.ID)))
+
+	client := &http.Client{
+		Timeout: 30 * time.Minute,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, // Skip certificate verification for local network
+			},
+			DisableCompression: true,
+		},
+	}
+	resp, err := client.Get(downloadURL)
+	if err != nil {
+		return fmt.Errorf("error sending download request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed: received status code %d", resp.StatusCode)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return fmt.Errorf("error creating directory: %w", err)
+	}
+	// Like received files, downloads go to a .part file first
+	part, err := createPart(filePath)
+	if err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+	defer part.Close()
+
+	size := resp.ContentLength
+	if size < 0 {
+		size = file.Size
+	}
+	bar := newProgressBar(size, fmt.Sprintf("Downloading %s", file.FileName))
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(part, hash, bar), resp.Body)
+	if err != nil {
+		os.Remove(part.Name())
+		return fmt.Errorf("error writing file: %w", err)
+	}
+
+	filePath, err = commitPart(part, written, hash.Sum(nil), file, filePath, false)
+	if err != nil {
+		return fmt.Errorf("error saving %s: %w", file.FileName, err)
+	}
+
+	logger.Success("File saved to:", filePath)
+	return nil
+}
+
+// FetchFiles lists the files shared by target (an IP or a device alias) and
+// downloads the selected ones. With all set, every file is downloaded without
+// asking.
+func FetchFiles(target string, pin string, all bool) error {
+	if err := os.MkdirAll(config.ConfigData.SaveDir, 0o755); err != nil {
+		return fmt.Errorf("error creating save directory: %w", err)
+	}
+
+	discovery.ListenAndStartBroadcasts(nil)
+	device, err := discovery.ResolvePeer(target, resolveTimeout)
+	if err != nil {
+		return err
+	}
+
+	response, err := PrepareDownload(device, pin)
+	if err != nil {
+		return err
+	}
+	if len(response.Files) == 0 {
+		logger.Info("Peer is not sharing any files")
+		return nil
+	}
+
+	ids := make([]string, 0, len(response.Files))
+	if all || !term.IsTerminal(int(os.Stdin.Fd())) {
+		for id := range response.Files {
+			ids = append(ids, id)
+		}
+	} else {
+		title := fmt.Sprintf("%s (%s) is sharing %d file(s):", response.Info.Alias, device.IP, len(response.Files))
+		ids, _, err = tui.SelectFiles(title, response.Files, 0)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			logger.Info("Nothing selected")
+			return nil
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return response.Files[ids[i]].FileName < response.Files[ids[j]].FileName
+	})
+
+	for _, id := range ids {
+		if err := downloadFile(device, response.SessionID, response.Files[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/sha256"
+)
+
+// localFile is a file on disk offered to peers, by sending or sharing it
+type localFile struct {
+	Info models.FileInfo
+	Path string
+}
+
+// collectFiles describes every file under roots. Each file gets a random ID,
+// and its name is the slash-separated path relative to the parent of its
+// root, so a folder keeps its name and structure ("photos/2024/a.jpg").
+func collectFiles(roots []string) (map[string]localFile, error) {
+	files := make(map[string]localFile)
+	for _, root := range roots {
+		base := filepath.Dir(filepath.Clean(root))
+		err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			sha256Hash, err := sha256.CalculateSHA256(filePath)
+			if err != nil {
+				return fmt.Errorf("error calculating SHA256 hash: %w", err)
+			}
+			fileName, err := filepath.Rel(base, filePath)
+			if err != nil {
+				return err
+			}
+			fileType := mime.TypeByExtension(filepath.Ext(filePath))
+			if fileType == "" {
+				fileType = "application/octet-stream"
+			}
+			id := uuid.NewString()
+			files[id] = localFile{
+				Info: models.FileInfo{
+					ID:       id,
+					FileName: filepath.ToSlash(fileName),
+					Size:     info.Size(),
+					FileType: fileType,
+					SHA256:   sha256Hash,
+				},
+				Path: filePath,
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error walking the path: %w", err)
+		}
+	}
+	return files, nil
+}
+
+// fileInfos returns the metadata of files, keyed by ID
+func fileInfos(files map[string]localFile) map[string]models.FileInfo {
+	infos := make(map[string]models.FileInfo, len(files))
+	for id, file := range files {
+		infos[id] = file.Info
+	}
+	return infos
+}
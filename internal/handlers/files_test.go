@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// writeTree creates files under dir, keyed by slash-separated relative path
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// setConfig changes a string config value for the duration of a test
+func setConfig(t *testing.T, field *string, value string) {
+	t.Helper()
+	old := *field
+	*field = value
+	t.Cleanup(func() { *field = old })
+}
+
+// newReceiveServer starts a LocalSend receiver saving to saveDir without a
+// PIN and returns it as a device to send to
+func newReceiveServer(t *testing.T, saveDir string) models.SendModel {
+	t.Helper()
+	setConfig(t, &config.ConfigData.SaveDir, saveDir)
+	setConfig(t, &config.ConfigData.Pin, "")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/localsend/v2/prepare-upload", PrepareReceive)
+	mux.HandleFunc("/api/localsend/v2/upload", ReceiveHandler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return models.SendModel{IP: "127.0.0.1", Port: server.Listener.Addr().(*net.TCPAddr).Port, Protocol: "http"}
+}
+
+func TestCollectFilesKeepsStructure(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"project/README.md":      "top",
+		"project/docs/README.md": "docs",
+		"notes.txt":              "notes",
+	})
+
+	files, err := collectFiles([]string{filepath.Join(dir, "project"), filepath.Join(dir, "notes.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for id, file := range files {
+		if file.Info.ID != id {
+			t.Errorf("file %s has ID %s", id, file.Info.ID)
+		}
+		names = append(names, file.Info.FileName)
+	}
+	sort.Strings(names)
+	want := []string{"notes.txt", "project/README.md", "project/docs/README.md"}
+	if len(names) != len(want) {
+		t.Fatalf("file names = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("file names = %v, want %v", names, want)
+		}
+	}
+}
+
+func TestSendFolderRecreatesTree(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	device := newReceiveServer(t, dst)
+	writeTree(t, src, map[string]string{
+		"project/README.md":      "top",
+		"project/docs/README.md": "docs",
+	})
+
+	if err := sendToDevice(device, filepath.Join(src, "project"), ""); err != nil {
+		t.Fatalf("sendToDevice: %v", err)
+	}
+
+	for name, want := range map[string]string{"project/README.md": "top", "project/docs/README.md": "docs"} {
+		got, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+}
@@ -9,11 +9,18 @@ import (
 	"github.com/meowrain/localsend-go/internal/discovery/shared"
 )
 
+// GetInfoHandler returns our device info. A peer passing its own fingerprint
+// gets 412 when it reached itself.
 func GetInfoHandler(w http.ResponseWriter, r *http.Request) {
+	if shared.IsSelf(r.URL.Query().Get("fingerprint")) {
+		http.Error(w, "Self-discovered", http.StatusPreconditionFailed)
+		return
+	}
+
 	msg := shared.Message
 	res, err := json.Marshal(msg)
 	if err != nil {
-		logger.Errorf("json convert failed:", err)
+		logger.Errorf("json convert failed: %v", err)
 		http.Error(w, "json convert failed", http.StatusInternalServerError)
 		return
 	}
@@ -21,7 +28,7 @@ func GetInfoHandler(w http.ResponseWriter, r *http.Request) {
 	_, err = w.Write(res)
 	if err != nil {
 		http.Error(w, "Failed to write file", http.StatusInternalServerError)
-		logger.Errorf("Error writing file:", err)
+		logger.Errorf("Error writing file: %v", err)
 		return
 	}
 }
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+)
+
+func TestGetInfoHandlerDetectsSelf(t *testing.T) {
+	shared.InitMessage("self-fingerprint")
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		want        int
+	}{
+		{"no fingerprint", "", http.StatusOK},
+		{"other device", "peer-fingerprint", http.StatusOK},
+		{"self", "self-fingerprint", http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/localsend/v2/info?fingerprint="+tt.fingerprint, nil)
+			rec := httptest.NewRecorder()
+			GetInfoHandler(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterHandlerIgnoresSelf(t *testing.T) {
+	shared.InitMessage("self-fingerprint")
+
+	body := `{"alias":"Me","version":"2.0","deviceType":"headless","fingerprint":"self-fingerprint"}`
+	req := httptest.NewRequest("POST", "/api/localsend/v2/register", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	RegisterHandler(rec, req)
+
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+	for _, device := range shared.DeviceList() {
+		if device.Fingerprint == "self-fingerprint" {
+			t.Fatal("node lists itself after registering with itself")
+		}
+	}
+}
+
+func TestRegisterHandlerIPv6(t *testing.T) {
+	shared.InitMessage("self-fingerprint")
+
+	body := `{"alias":"IPv6 Peer","version":"2.0","deviceType":"desktop","fingerprint":"ipv6-peer","port":8080,"protocol":"http"}`
+	req := httptest.NewRequest("POST", "/api/localsend/v2/register", strings.NewReader(body))
+	req.RemoteAddr = "[::1]:40000"
+	rec := httptest.NewRecorder()
+	RegisterHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	device := shared.LookupDevice("::1")
+	if device.DeviceName != "IPv6 Peer" {
+		t.Fatalf("device registered from ::1 not found, got %+v", device)
+	}
+	if want := "http://[::1]:8080/api/localsend/v2/info"; device.URL("/api/localsend/v2/info") != want {
+		t.Fatalf("URL = %s, want %s", device.URL("/api/localsend/v2/info"), want)
+	}
+}
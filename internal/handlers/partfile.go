@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// partPattern matches the names of the temporary files created by createPart.
+// The suffix is distinctive so that no user file is ever taken for one.
+var partPattern = regexp.MustCompile(`^\..+\.\d+\.localsend-part$`)
+
+// createPart creates the hidden temporary file a received file is written to
+// before it is moved to path, e.g. ".photo.jpg.123456.localsend-part". It
+// lives in the same directory so the final rename never crosses filesystems.
+func createPart(path string) (*os.File, error) {
+	return os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.localsend-part")
+}
+
+// commitPart flushes a completely received .part file to disk, checks it
+// against the size and SHA-256 announced by the sender and moves it to path,
+// applying the on_conflict policy. It returns the final path. The .part file
+// is removed when anything fails.
+func commitPart(part *os.File, written int64, sum []byte, info models.FileInfo, path string, overwrite bool) (string, error) {
+	err := part.Sync()
+	if closeErr := part.Close(); err == nil {
+		err = closeErr
+	}
+	switch {
+	case err != nil:
+		err = fmt.Errorf("flush file failed: %w", err)
+	case written != info.Size:
+		err = fmt.Errorf("size mismatch: received %d of %d bytes", written, info.Size)
+	case info.SHA256 != "" && !strings.EqualFold(hex.EncodeToString(sum), info.SHA256):
+		err = errors.New("SHA-256 mismatch")
+	}
+	if err != nil {
+		os.Remove(part.Name())
+		return "", err
+	}
+
+	finalPath, err := placeFile(part.Name(), path, overwrite)
+	if err != nil {
+		os.Remove(part.Name())
+		return "", err
+	}
+	syncDir(filepath.Dir(finalPath))
+	return finalPath, nil
+}
+
+// syncDir flushes a directory so a rename in it survives a power loss. It is
+// best effort since not every platform can sync directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	d.Sync()
+}
+
+// CleanupPartFiles removes the .part files left in the save directory by
+// transfers that were interrupted by a crash or power loss. Files written to
+// within the session timeout are kept, as they may belong to another instance
+// sharing the directory.
+func CleanupPartFiles() {
+	removed := 0
+	err := filepath.WalkDir(config.ConfigData.SaveDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || !partPattern.MatchString(d.Name()) {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || time.Since(info.ModTime()) < sessionTimeout {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			logger.Errorf("Failed to remove %s: %v", path, err)
+		} else {
+			removed++
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Errorf("Failed to clean up interrupted transfers: %v", err)
+	}
+	if removed > 0 {
+		logger.Infof("Removed %d incomplete file(s) of interrupted transfers", removed)
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestCommitPartVerifiesContent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "photo.jpg")
+	sum := sha256.Sum256([]byte("data"))
+	info := models.FileInfo{FileName: "photo.jpg", Size: 4, SHA256: hex.EncodeToString(sum[:])}
+
+	for _, tt := range []struct {
+		name    string
+		content string
+		ok      bool
+	}{
+		{"truncated", "da", false},
+		{"corrupted", "dat!", false},
+		{"complete", "data", true},
+	} {
+		part, err := createPart(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.WriteString(tt.content)
+		got := sha256.Sum256([]byte(tt.content))
+
+		_, err = commitPart(part, int64(len(tt.content)), got[:], info, path, false)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: commitPart error = %v", tt.name, err)
+		}
+		if _, statErr := os.Stat(path); (statErr == nil) != tt.ok {
+			t.Errorf("%s: final file exists = %v", tt.name, statErr == nil)
+		}
+		if _, statErr := os.Stat(part.Name()); !os.IsNotExist(statErr) {
+			t.Errorf("%s: part file was left behind", tt.name)
+		}
+	}
+}
+
+func TestCleanupPartFiles(t *testing.T) {
+	dir := t.TempDir()
+	setConfig(t, &config.ConfigData.SaveDir, dir)
+	files := map[string]bool{ // Whether the file is kept
+		".photo.jpg.123456.localsend-part":      false,
+		"docs/.notes.txt.987654.localsend-part": false,
+		".backup.2024.part":                     true,
+		".notes.part":                           true,
+		"photo.jpg.localsend-part":              true,
+		"photo.jpg":                             true,
+	}
+	for name := range files {
+		writeTree(t, dir, map[string]string{name: "data"})
+		old := time.Now().Add(-2 * sessionTimeout)
+		os.Chtimes(filepath.Join(dir, filepath.FromSlash(name)), old, old)
+	}
+	// A transfer of another instance sharing the directory is in progress
+	writeTree(t, dir, map[string]string{".video.mp4.555555.localsend-part": "data"})
+	files[".video.mp4.555555.localsend-part"] = true
+
+	CleanupPartFiles()
+
+	for name, want := range files {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", name, err == nil, want)
+		}
+	}
+}
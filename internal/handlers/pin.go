@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+const (
+	maxPinAttempts = 3               // Failed attempts before an IP is locked out
+	pinLockout     = 5 * time.Minute // How long a locked out IP is rejected
+)
+
+type pinAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+var (
+	pinFailures = make(map[string]*pinAttempts) // Failed attempts by remote IP
+	pinMutex    sync.Mutex
+)
+
+// checkPin validates the ?pin= query parameter against expected. It answers
+// 401 for a missing or wrong PIN and 429 while the caller is locked out, and
+// reports whether the request may proceed. An empty expected PIN disables the
+// check.
+func checkPin(w http.ResponseWriter, r *http.Request, expected string) bool {
+	if expected == "" {
+		return true
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	pinMutex.Lock()
+	defer pinMutex.Unlock()
+
+	now := time.Now()
+	prunePinFailures(now)
+	attempts, ok := pinFailures[ip]
+	if ok && now.Before(attempts.lockedUntil) {
+		http.Error(w, "Too many PIN attempts", http.StatusTooManyRequests)
+		return false
+	}
+
+	pin := r.URL.Query().Get("pin")
+	if pin == "" {
+		http.Error(w, "PIN required", http.StatusUnauthorized)
+		return false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(pin), []byte(expected)) == 1 {
+		delete(pinFailures, ip)
+		return true
+	}
+
+	if !ok {
+		attempts = &pinAttempts{}
+		pinFailures[ip] = attempts
+	}
+	attempts.failures++
+	attempts.lastFailure = now
+	if attempts.failures >= maxPinAttempts {
+		logger.Warnf("Too many wrong PINs from %s, locking out for %v", ip, pinLockout)
+		attempts.failures = 0
+		attempts.lockedUntil = now.Add(pinLockout)
+	}
+
+	http.Error(w, "Invalid PIN", http.StatusUnauthorized)
+	return false
+}
+
+// prunePinFailures forgets IPs whose last failure and lockout are over for
+// longer than the lockout window. Callers must hold pinMutex.
+func prunePinFailures(now time.Time) {
+	for ip, attempts := range pinFailures {
+		if now.Sub(attempts.lastFailure) >= pinLockout && !now.Before(attempts.lockedUntil) {
+			delete(pinFailures, ip)
+		}
+	}
+}
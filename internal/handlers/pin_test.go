@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// resetPinFailures clears the failed PIN attempts before and after a test
+func resetPinFailures(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		pinMutex.Lock()
+		pinFailures = make(map[string]*pinAttempts)
+		pinMutex.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// pinRequest runs checkPin for a request from ip and returns the status code
+func pinRequest(ip, pin string) int {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if checkPin(w, r, "1234") {
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/localsend/v2/prepare-upload?pin="+pin, nil)
+	req.RemoteAddr = ip + ":40000"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestCheckPin(t *testing.T) {
+	resetPinFailures(t)
+
+	tests := []struct {
+		name string
+		ip   string
+		pin  string
+		want int
+	}{
+		{"missing PIN", "192.168.1.2", "", http.StatusUnauthorized},
+		{"wrong PIN", "192.168.1.2", "0000", http.StatusUnauthorized},
+		{"correct PIN", "192.168.1.2", "1234", http.StatusOK},
+		{"first failure", "192.168.1.3", "0000", http.StatusUnauthorized},
+		{"second failure", "192.168.1.3", "0000", http.StatusUnauthorized},
+		{"third failure", "192.168.1.3", "0000", http.StatusUnauthorized},
+		{"locked out", "192.168.1.3", "1234", http.StatusTooManyRequests},
+		{"other IP", "192.168.1.4", "1234", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := pinRequest(tt.ip, tt.pin); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPinSuccessClearsFailures(t *testing.T) {
+	resetPinFailures(t)
+
+	pinRequest("192.168.1.2", "0000")
+	pinRequest("192.168.1.2", "0000")
+	if got := pinRequest("192.168.1.2", "1234"); got != http.StatusOK {
+		t.Fatalf("correct PIN: status = %d", got)
+	}
+
+	pinMutex.Lock()
+	_, ok := pinFailures["192.168.1.2"]
+	pinMutex.Unlock()
+	if ok {
+		t.Fatal("failures kept after a correct PIN")
+	}
+	// Two more failures don't lock out since the counter restarted
+	pinRequest("192.168.1.2", "0000")
+	pinRequest("192.168.1.2", "0000")
+	if got := pinRequest("192.168.1.2", "1234"); got != http.StatusOK {
+		t.Fatalf("status = %d after the counter was cleared", got)
+	}
+}
+
+func TestCheckPinPrunesExpiredFailures(t *testing.T) {
+	resetPinFailures(t)
+
+	past := time.Now().Add(-2 * pinLockout)
+	pinMutex.Lock()
+	pinFailures["192.168.1.5"] = &pinAttempts{failures: 1, lastFailure: past}
+	pinFailures["192.168.1.6"] = &pinAttempts{lastFailure: past, lockedUntil: past.Add(pinLockout)}
+	pinMutex.Unlock()
+
+	pinRequest("192.168.1.2", "0000")
+
+	pinMutex.Lock()
+	defer pinMutex.Unlock()
+	if len(pinFailures) != 1 || pinFailures["192.168.1.2"] == nil {
+		t.Fatalf("expired entries not pruned: %v", pinFailures)
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// newProgressBar creates the transfer progress bar shared by uploads and downloads
+func newProgressBar(size int64, description string) *progressbar.ProgressBar {
+	return progressbar.NewOptions64(
+		size,
+		progressbar.OptionSetDescription(description),
+		progressbar.OptionSetWidth(15),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionThrottle(time.Second), // Reduce refresh rate to minimize flicker
+		progressbar.OptionShowCount(),
+		progressbar.OptionClearOnFinish(), // Clear progress bar on completion
+		progressbar.OptionSetRenderBlankState(true),
+		progressbar.OptionSetPredictTime(true), // Predict remaining time
+		progressbar.OptionFullWidth(),          // Use full width display
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "█",
+			SaucerHead:    "█",
+			SaucerPadding: "░",
+			BarStart:      "|",
+			BarEnd:        "|",
+		}),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprint(os.Stderr, "\n")
+		}),
+	)
+}
@@ -1,31 +1,91 @@
 package handlers
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/meowrain/localsend-go/internal/config"
 	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/session"
+	"github.com/meowrain/localsend-go/internal/tui"
 
 	"github.com/meowrain/localsend-go/internal/utils/clipboard"
 	"github.com/meowrain/localsend-go/internal/utils/logger"
-	"github.com/schollz/progressbar/v3"
+	"github.com/meowrain/localsend-go/internal/utils/safepath"
+	"golang.org/x/term"
+)
+
+const (
+	sessionTimeout         = 5 * time.Minute // Idle time after which a receive session expires
+	sessionCleanupInterval = 30 * time.Second
 )
 
 var (
-	sessionIDCounter = 0
-	sessionMutex     sync.Mutex
-	fileNames        = make(map[string]string) // Stores file names by ID
+	receiveSessions = session.NewManager(sessionTimeout)
+	receivePrompt   bool // Ask the user before accepting incoming transfers
 )
 
+// SetReceivePrompt enables or disables the accept/decline prompt for incoming
+// transfers. It should only be enabled when nothing else uses the terminal.
+func SetReceivePrompt(enabled bool) {
+	receivePrompt = enabled
+}
+
+// confirmTransfer returns the IDs of the files the user accepts, or nil if the
+// transfer is rejected. The configured default action applies when the prompt
+// times out or stdin is not a terminal.
+func confirmTransfer(sender models.Info, files map[string]models.FileInfo) []string {
+	all := make([]string, 0, len(files))
+	for id := range files {
+		all = append(all, id)
+	}
+	if !receivePrompt {
+		return all
+	}
+
+	defaultAction := func(reason string) []string {
+		logger.Infof("%s, applying default action: %s", reason, config.ConfigData.Receive.DefaultAction)
+		if config.ConfigData.Receive.DefaultAction == "accept" {
+			return all
+		}
+		return nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return defaultAction("No terminal to ask for confirmation")
+	}
+
+	timeout := time.Duration(config.ConfigData.Receive.PromptTimeout) * time.Second
+	accepted, timedOut, err := tui.ConfirmTransfer(sender, files, timeout)
+	if err != nil {
+		logger.Errorf("Failed to show confirmation prompt: %v", err)
+		return defaultAction("Confirmation prompt failed")
+	}
+	if timedOut {
+		return defaultAction("No answer before timeout")
+	}
+	return accepted
+}
+
+// StartSessionCleanup starts expiring abandoned receive sessions
+func StartSessionCleanup() {
+	receiveSessions.StartCleanup(sessionCleanupInterval)
+}
+
 func PrepareReceive(w http.ResponseWriter, r *http.Request) {
+	if !checkPin(w, r, config.ConfigData.Pin) {
+		return
+	}
+
 	var req models.PrepareReceiveRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
@@ -35,19 +95,57 @@ func PrepareReceive(w http.ResponseWriter, r *http.Request) {
 
 	logger.Infof("Received request from %s,device is %s", req.Info.Alias, req.Info.DeviceModel)
 
-	sessionMutex.Lock()
-	sessionIDCounter++
-	sessionID := fmt.Sprintf("session-%d", sessionIDCounter)
-	sessionMutex.Unlock()
+	senderIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Invalid remote address", http.StatusBadRequest)
+		return
+	}
 
-	files := make(map[string]string)
-	for fileID, fileInfo := range req.Files {
-		token := fmt.Sprintf("token-%s", fileID)
-		files[fileID] = token
+	if len(req.Files) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	for _, fileInfo := range req.Files {
+		if _, err := safepath.Clean(fileInfo.FileName); err != nil {
+			logger.Errorf("Rejected file name %q from %s: %v", fileInfo.FileName, req.Info.Alias, err)
+			http.Error(w, "Invalid file name", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sess, err := receiveSessions.Create(senderIP, req.Info, req.Files)
+	if errors.Is(err, session.ErrBlocked) {
+		http.Error(w, "Blocked by another session", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		logger.Errorf("Error creating session: %v", err)
+		return
+	}
+
+	accepted := confirmTransfer(req.Info, req.Files)
+	if len(accepted) == 0 {
+		receiveSessions.Cancel(sess.ID)
+		logger.Infof("Rejected transfer from %s", req.Info.Alias)
+		http.Error(w, "Rejected", http.StatusForbidden)
+		return
+	}
 
-		// Save file name
-		fileNames[fileID] = fileInfo.FileName
+	accepted, overwrite := resolveConflicts(accepted, req.Files)
+	if len(accepted) == 0 {
+		receiveSessions.Cancel(sess.ID)
+		logger.Infof("All files from %s already exist, nothing to transfer", req.Info.Alias)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !receiveSessions.Retain(sess.ID, accepted) || !receiveSessions.SetOverwrite(sess.ID, overwrite) {
+		logger.Infof("Session of %s closed before the transfer was accepted", req.Info.Alias)
+		http.Error(w, "Rejected", http.StatusForbidden)
+		return
+	}
 
+	for _, fileID := range accepted {
+		fileInfo := req.Files[fileID]
 		if strings.HasSuffix(fileInfo.FileName, ".txt") {
 			logger.Success("TXT file content preview:", string(fileInfo.Preview))
 			clipboard.WriteToClipBoard(fileInfo.Preview)
@@ -55,8 +153,8 @@ func PrepareReceive(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := models.PrepareReceiveResponse{
-		SessionID: sessionID,
-		Files:     files,
+		SessionID: sess.ID,
+		Files:     sess.Tokens(),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
@@ -73,31 +171,51 @@ func ReceiveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get file name using fileID
-	fileName, ok := fileNames[fileID]
-	if !ok {
-		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+	uploaderIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Invalid remote address", http.StatusBadRequest)
+		return
+	}
+
+	// Validate session, token and uploader IP
+	sess, sessFile, err := receiveSessions.StartUpload(sessionID, fileID, token, uploaderIP)
+	if errors.Is(err, session.ErrBlocked) {
+		http.Error(w, "Blocked by another session", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Invalid token or IP address", http.StatusForbidden)
 		return
 	}
+	completed := false
+	defer func() {
+		receiveSessions.FinishUpload(sessionID, fileID, completed)
+	}()
+	fileName := sessFile.Info.FileName
 
-	// Generate file path, preserving the file extension
-	filePath := filepath.Join(config.ConfigData.SaveDir, fileName)
+	// File names are slash-separated paths relative to the sent folder's
+	// parent, so the sender's folder structure is recreated under SaveDir
+	filePath, err := safepath.Join(config.ConfigData.SaveDir, fileName)
+	if err != nil {
+		http.Error(w, "Invalid file name", http.StatusBadRequest)
+		return
+	}
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(filePath)
-	err := os.MkdirAll(dir, os.ModePerm)
+	err = os.MkdirAll(dir, os.ModePerm)
 	if err != nil {
 		http.Error(w, "Failed to create directory", http.StatusInternalServerError)
-		logger.Errorf("Error creating directory:", err)
+		logger.Errorf("Error creating directory: %v", err)
 		return
 	}
-	// Create file
-	file, err := os.Create(filePath)
+	// Data is written to a hidden .part file and only moved to its final name
+	// once complete, so an interrupted transfer never looks like a whole file
+	part, err := createPart(filePath)
 	if err != nil {
 		http.Error(w, "Failed to create file", http.StatusInternalServerError)
-		logger.Errorf("Error creating file:", err)
+		logger.Errorf("Error creating file: %v", err)
 		return
 	}
-	defer file.Close()
+	defer part.Close()
 
 	// Create a context to handle request cancellation
 	ctx := r.Context()
@@ -106,30 +224,11 @@ func ReceiveHandler(w http.ResponseWriter, r *http.Request) {
 	contentLength := r.ContentLength
 
 	// Create progress bar
-	bar := progressbar.NewOptions64(
-		contentLength,
-		progressbar.OptionSetDescription(fmt.Sprintf("Downloading %s", fileName)),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionThrottle(time.Second), // Reduce refresh rate to minimize flicker
-		progressbar.OptionShowCount(),
-		progressbar.OptionClearOnFinish(), // Clear progress bar on completion
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionSetPredictTime(true), // Predict remaining time
-		progressbar.OptionFullWidth(),          // Use full width display
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "█",
-			SaucerHead:    "█",
-			SaucerPadding: "░",
-			BarStart:      "|",
-			BarEnd:        "|",
-		}),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-	)
+	bar := newProgressBar(contentLength, fmt.Sprintf("Downloading %s", fileName))
 
 	buffer := make([]byte, 2*1024*1024) // 2MB buffer
+	hash := sha256.New()
+	var written int64
 
 	// Use a channel to handle transfer completion or cancellation
 	done := make(chan error, 1)
@@ -146,38 +245,66 @@ func ReceiveHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			_, err = file.Write(buffer[:n])
+			_, err = part.Write(buffer[:n])
 			if err != nil {
 				done <- fmt.Errorf("Write file failed: %w", err)
 				return
 			}
 
+			hash.Write(buffer[:n])
+			written += int64(n)
 			bar.Add(n)
 		}
 	}()
 
+	// stopCopy makes the copy goroutine's pending read fail and waits for it,
+	// so neither the body nor the part file is used after the handler returns
+	stopCopy := func() {
+		http.NewResponseController(w).SetReadDeadline(time.Now())
+		r.Body.Close()
+		<-done
+	}
+
 	// Wait for transfer completion or cancellation
 	select {
 	case err := <-done:
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			logger.Errorf("Transfer error:", err)
+			logger.Errorf("Transfer error: %v", err)
 			// Delete incomplete file
-			os.Remove(filePath)
+			os.Remove(part.Name())
 			return
 		}
 	case <-ctx.Done():
 		// Request was cancelled
 		logger.Info("Transfer canceled by client")
+		stopCopy()
 		// Delete incomplete file
-		os.Remove(filePath)
+		os.Remove(part.Name())
 		// Close connection
 		if conn, ok := w.(http.CloseNotifier); ok {
 			conn.CloseNotify()
 		}
 		return
+	case <-sess.Context().Done():
+		// Session was cancelled or expired
+		logger.Info("Transfer canceled, session closed")
+		stopCopy()
+		os.Remove(part.Name())
+		http.Error(w, "Session closed", http.StatusConflict)
+		return
+	}
+
+	// Verify and move into place, applying the on_conflict policy if the
+	// name is taken
+	filePath, err = commitPart(part, written, hash.Sum(nil), sessFile.Info, filePath, sessFile.Overwrite)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Errorf("Error saving %s: %v", fileName, err)
+		return
 	}
 
+	completed = true
 	logger.Success("File saved to:", filePath)
 	w.WriteHeader(http.StatusOK)
 }
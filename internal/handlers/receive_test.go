@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestPrepareReceiveRejectsTraversal(t *testing.T) {
+	setConfig(t, &config.ConfigData.SaveDir, t.TempDir())
+	setConfig(t, &config.ConfigData.Pin, "")
+
+	body, _ := json.Marshal(models.PrepareReceiveRequest{
+		Info: models.Info{Alias: "Mallory"},
+		Files: map[string]models.FileInfo{
+			"a": {ID: "a", FileName: "../../.bashrc", Size: 1},
+		},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/localsend/v2/prepare-upload", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	PrepareReceive(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+// TestCancelSessionStopsUpload checks that closing the session in the middle
+// of an upload ends the handler and removes the partial file
+func TestCancelSessionStopsUpload(t *testing.T) {
+	dst := t.TempDir()
+	device := newReceiveServer(t, dst)
+
+	files := map[string]models.FileInfo{"a": {ID: "a", FileName: "big.bin", Size: 1 << 20}}
+	prepared, err := SendFileToOtherDevicePrepare(device, files, "")
+	if err != nil {
+		t.Fatalf("prepare-upload: %v", err)
+	}
+
+	body, writer := io.Pipe()
+	defer writer.Close()
+	query := url.Values{"sessionId": {prepared.SessionID}, "fileId": {"a"}, "token": {prepared.Files["a"]}}
+	result := make(chan int, 1)
+	go func() {
+		resp, err := http.Post(device.URL("/api/localsend/v2/upload?"+query.Encode()), "application/octet-stream", body)
+		if err != nil {
+			result <- 0
+			return
+		}
+		resp.Body.Close()
+		result <- resp.StatusCode
+	}()
+
+	writer.Write(make([]byte, 1024))
+	// Wait for the upload to start writing its part file
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if entries, _ := os.ReadDir(dst); len(entries) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("upload did not start")
+		}
+	}
+	receiveSessions.Cancel(prepared.SessionID)
+
+	select {
+	case code := <-result:
+		if code != http.StatusConflict {
+			t.Fatalf("status = %d, want %d", code, http.StatusConflict)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("upload did not stop after the session was cancelled")
+	}
+	if entries, _ := os.ReadDir(dst); len(entries) != 0 {
+		t.Fatalf("save directory holds %v after cancel", entries)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// RegisterHandler handles the HTTP discovery fallback: the caller announces
+// itself and we answer with our own device info
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var info models.Info
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if info.Alias == "" {
+		http.Error(w, "Missing alias", http.StatusBadRequest)
+		return
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Invalid remote address", http.StatusBadRequest)
+		return
+	}
+
+	logger.Debugf("Received register request from %s (%s)", info.Alias, ip)
+
+	if shared.IsSelf(info.Fingerprint) {
+		http.Error(w, "Self-discovered", http.StatusPreconditionFailed)
+		return
+	}
+
+	shared.AddDevice(ip, models.BroadcastMessage{
+		Alias:       info.Alias,
+		Version:     info.Version,
+		DeviceModel: info.DeviceModel,
+		DeviceType:  info.DeviceType,
+		Fingerprint: info.Fingerprint,
+		Port:        info.Port,
+		Protocol:    info.Protocol,
+		Download:    info.Download,
+		LastSeen:    time.Now(),
+	})
+
+	shared.NotifyUpdate()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shared.LocalInfo())
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/tls"
@@ -8,8 +9,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/meowrain/localsend-go/internal/config"
@@ -18,50 +22,17 @@ import (
 	"github.com/meowrain/localsend-go/internal/models"
 	"github.com/meowrain/localsend-go/internal/tui"
 	"github.com/meowrain/localsend-go/internal/utils/logger"
-	"github.com/meowrain/localsend-go/internal/utils/sha256"
-	"github.com/schollz/progressbar/v3"
+	"github.com/meowrain/localsend-go/internal/utils/safepath"
 )
 
-// SendFileToOtherDevicePrepare prepares file metadata and sends it to the target device
-func SendFileToOtherDevicePrepare(ip string, path string) (*models.PrepareReceiveResponse, error) {
-	// Prepare metadata for all files
-	files := make(map[string]models.FileInfo)
-	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			sha256Hash, err := sha256.CalculateSHA256(filePath)
-			if err != nil {
-				return fmt.Errorf("error calculating SHA256 hash: %w", err)
-			}
-			fileMetadata := models.FileInfo{
-				ID:       info.Name(), // Use filename as ID
-				FileName: info.Name(),
-				Size:     info.Size(),
-				FileType: filepath.Ext(filePath),
-				SHA256:   sha256Hash,
-			}
-			files[fileMetadata.ID] = fileMetadata
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("error walking the path: %w", err)
-	}
+const maxPinPrompts = 3 // How many times the user is asked for a PIN
 
+// SendFileToOtherDevicePrepare sends the metadata of files to the target device.
+// If the receiver requires a PIN, pin is tried first and the user is then prompted for it.
+func SendFileToOtherDevicePrepare(device models.SendModel, files map[string]models.FileInfo, pin string) (*models.PrepareReceiveResponse, error) {
 	// Create and populate the PrepareReceiveRequest struct
 	request := models.PrepareReceiveRequest{
-		Info: models.Info{
-			Alias:       shared.Message.Alias,
-			Version:     shared.Message.Version,
-			DeviceModel: shared.Message.DeviceModel,
-			DeviceType:  shared.Message.DeviceType,
-			Fingerprint: shared.Message.Fingerprint,
-			Port:        shared.Message.Port,
-			Protocol:    shared.Message.Protocol,
-			Download:    shared.Message.Download,
-		},
+		Info:  shared.LocalInfo(),
 		Files: files,
 	}
 
@@ -72,7 +43,6 @@ func SendFileToOtherDevicePrepare(ip string, path string) (*models.PrepareReceiv
 	}
 
 	// Send POST request
-	url := fmt.Sprintf("https://%s:53317/api/localsend/v2/prepare-upload", ip)
 	client := &http.Client{
 		Timeout: 60 * time.Second, // Transfer timeout
 		Transport: &http.Transport{
@@ -81,21 +51,50 @@ func SendFileToOtherDevicePrepare(ip string, path string) (*models.PrepareReceiv
 			},
 		},
 	}
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(requestJson))
-	if err != nil {
-		return nil, fmt.Errorf("error sending POST request: %w", err)
+
+	var resp *http.Response
+	for prompts := 0; ; prompts++ {
+		prepareURL := device.URL("/api/localsend/v2/prepare-upload")
+		if pin != "" {
+			prepareURL += "?pin=" + url.QueryEscape(pin)
+		}
+		resp, err = client.Post(prepareURL, "application/json", bytes.NewBuffer(requestJson))
+		if err != nil {
+			return nil, fmt.Errorf("error sending POST request: %w", err)
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			break
+		}
+		resp.Body.Close()
+
+		if prompts >= maxPinPrompts {
+			return nil, fmt.Errorf("invalid PIN")
+		}
+		if pin != "" {
+			fmt.Println("Wrong PIN.")
+		}
+		pin, err = promptPin()
+		if err != nil {
+			return nil, err
+		}
 	}
 	defer resp.Body.Close()
 
 	// Check response
+	if resp.StatusCode == http.StatusNoContent {
+		// Finished, the receiver needs none of the files
+		return &models.PrepareReceiveResponse{}, nil
+	}
 	if resp.StatusCode != http.StatusOK {
 		switch resp.StatusCode {
-		case 204:
-			return nil, fmt.Errorf("finished (No file transfer needed)")
 		case 400:
 			return nil, fmt.Errorf("invalid body")
 		case 403:
 			return nil, fmt.Errorf("rejected")
+		case 409:
+			return nil, fmt.Errorf("blocked by another session")
+		case 429:
+			return nil, fmt.Errorf("too many PIN attempts, try again later")
 		case 500:
 			return nil, fmt.Errorf("unknown error by receiver")
 		}
@@ -111,8 +110,22 @@ func SendFileToOtherDevicePrepare(ip string, path string) (*models.PrepareReceiv
 	return &prepareReceiveResponse, nil
 }
 
+// promptPin asks the user for the PIN requested by the receiver
+func promptPin() (string, error) {
+	fmt.Print("The receiver requires a PIN: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("error reading PIN: %w", err)
+	}
+	pin := strings.TrimSpace(line)
+	if pin == "" {
+		return "", fmt.Errorf("no PIN entered")
+	}
+	return pin, nil
+}
+
 // uploadFile uploads a single file to the target device
-func uploadFile(ctx context.Context, ip, sessionId, fileId, token, filePath string) error {
+func uploadFile(ctx context.Context, device models.SendModel, sessionId, fileId, token, filePath string) error {
 	// Open the file to send
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -128,32 +141,11 @@ func uploadFile(ctx context.Context, ip, sessionId, fileId, token, filePath stri
 	fileSize := fileInfo.Size()
 
 	// Create progress bar
-	bar := progressbar.NewOptions64(
-		fileSize,
-		progressbar.OptionSetDescription(fmt.Sprintf("Uploading %s", filepath.Base(filePath))),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionThrottle(time.Second), // Reduce refresh rate to minimize flicker
-		progressbar.OptionShowCount(),
-		progressbar.OptionClearOnFinish(), // Clear progress bar on completion
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionSetPredictTime(true), // Predict remaining time
-		progressbar.OptionFullWidth(),          // Use full width display
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "█",
-			SaucerHead:    "█",
-			SaucerPadding: "░",
-			BarStart:      "|",
-			BarEnd:        "|",
-		}),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-	)
+	bar := newProgressBar(fileSize, fmt.Sprintf("Uploading %s", filepath.Base(filePath)))
 
 	// Build the file upload URL
-	uploadURL := fmt.Sprintf("https://%s:53317/api/localsend/v2/upload?sessionId=%s&fileId=%s&token=%s",
-		ip, sessionId, fileId, token)
+	uploadURL := device.URL(fmt.Sprintf("/api/localsend/v2/upload?sessionId=%s&fileId=%s&token=%s",
+		url.QueryEscape(sessionId), url.QueryEscape(fileId), url.QueryEscape(token)))
 
 	// Use a pipe to avoid loading the entire file into memory
 	pr, pw := io.Pipe()
@@ -230,19 +222,36 @@ func uploadFile(ctx context.Context, ip, sessionId, fileId, token, filePath stri
 	return nil
 }
 
-// SendFile discovers devices, lets the user pick one, and sends the file
-func SendFile(path string) error {
+// SendFile discovers devices, lets the user pick one, and sends the file.
+// pin is used if the receiver requires one.
+func SendFile(path string, pin string) error {
 	updates := make(chan []models.SendModel)
 	discovery.ListenAndStartBroadcasts(updates)
 	fmt.Println("Please select a device you want to send file to:")
-	ip, err := tui.SelectDevice(updates)
+	device, err := tui.SelectDevice(updates)
+	if err != nil {
+		return err
+	}
+	if device.IP == "" {
+		return fmt.Errorf("no device selected")
+	}
+	return sendToDevice(device, path, pin)
+}
+
+// sendToDevice sends the file or folder at path to device
+func sendToDevice(device models.SendModel, path string, pin string) error {
+	files, err := collectFiles([]string{path})
 	if err != nil {
 		return err
 	}
-	response, err := SendFileToOtherDevicePrepare(ip, path)
+	response, err := SendFileToOtherDevicePrepare(device, fileInfos(files), pin)
 	if err != nil {
 		return err
 	}
+	if len(response.Files) == 0 {
+		logger.Info("Nothing to transfer, the receiver already has all files")
+		return nil
+	}
 
 	// Create a context for cancellation
 	ctx, cancel := context.WithCancel(context.Background())
@@ -253,26 +262,26 @@ func SendFile(path string) error {
 	RegisterCancelHandler(response.SessionID, cancel)
 	defer UnregisterCancelHandler(response.SessionID)
 
-	// Walk directory and upload files
-	err = filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			fileId := info.Name()
-			token, ok := response.Files[fileId]
-			if !ok {
-				return fmt.Errorf("token not found for file: %s", fileId)
-			}
-			err = uploadFile(ctx, ip, response.SessionID, fileId, token, filePath)
-			if err != nil {
-				return fmt.Errorf("error uploading file: %w", err)
-			}
+	// Upload the files the receiver accepted, in path order
+	ids := make([]string, 0, len(response.Files))
+	for id := range response.Files {
+		if _, ok := files[id]; !ok {
+			return fmt.Errorf("receiver returned a token for unknown file %s", id)
 		}
-		return nil
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return files[ids[i]].Info.FileName < files[ids[j]].Info.FileName
 	})
-	if err != nil {
-		return fmt.Errorf("error walking the path: %w", err)
+	if skipped := len(files) - len(ids); skipped > 0 {
+		logger.Infof("The receiver skipped %d of %d file(s)", skipped, len(files))
+	}
+
+	for _, id := range ids {
+		err = uploadFile(ctx, device, response.SessionID, id, response.Files[id], files[id].Path)
+		if err != nil {
+			return fmt.Errorf("error uploading %s: %w", files[id].Info.FileName, err)
+		}
 	}
 
 	return nil
@@ -303,7 +312,12 @@ func NormalSendHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Only create a subdirectory if the frontend provided a non-empty directory name
 	if uploadedDirName != "" {
-		finalUploadDir = filepath.Join(uploadDir, uploadedDirName)
+		dir, err := safepath.Join(uploadDir, uploadedDirName)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid directory name: %v", err), http.StatusBadRequest)
+			return
+		}
+		finalUploadDir = dir
 	} else {
 		logger.Debug("No directoryName provided, uploading to root uploads dir.") // Debug log - no directoryName
 	}
@@ -326,7 +340,11 @@ func NormalSendHandler(w http.ResponseWriter, r *http.Request) {
 		defer file.Close()
 
 		// Build destination path (using finalUploadDir as root)
-		destPath := filepath.Join(finalUploadDir, fileHeader.Filename)
+		destPath, err := safepath.Join(finalUploadDir, fileHeader.Filename)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid file name: %v", err), http.StatusBadRequest)
+			return
+		}
 		logger.Infof("Saving file '%s' to destPath: '%s'\n", fileHeader.Filename, destPath) // Debug log - file dest path
 
 		// Create destination directory if it doesn't exist
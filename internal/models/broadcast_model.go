@@ -13,4 +13,6 @@ type BroadcastMessage struct {
 	Download    bool      `json:"download"`    // Whether download API is supported
 	Announce    bool      `json:"announce"`    // Whether to announce presence
 	LastSeen    time.Time `json:"-"`           // Last discovery time (local use only)
+	Static      bool      `json:"-"`           // Configured in the static peer list (local use only)
+	Interface   string    `json:"-"`           // Interface the device was seen on (local use only)
 }
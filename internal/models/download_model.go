@@ -0,0 +1,7 @@
+package models
+
+type PrepareDownloadResponse struct {
+	Info      Info                `json:"info"`
+	SessionID string              `json:"sessionId"`
+	Files     map[string]FileInfo `json:"files"` // File ID to metadata map
+}
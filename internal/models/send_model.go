@@ -1,7 +1,42 @@
 package models
 
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPort is the LocalSend port used when a device does not advertise one
+const DefaultPort = 53317
+
 // SendModel represents a discovered device for sending files
 type SendModel struct {
-	DeviceName string
-	IP         string
+	DeviceName  string
+	DeviceType  string // mobile, desktop, web, headless or server
+	DeviceModel string // e.g. the OS or phone model
+	IP          string
+	Port        int    // HTTP(S) server port
+	Protocol    string // http or https
+	Fingerprint string
+	LastSeen    time.Time
+	Static      bool   // Configured in the static peer list
+	Interface   string // Interface the device was seen on, if known
+}
+
+// URL builds the address of an API endpoint on the device, e.g.
+// URL("/api/localsend/v2/info"). IPv6 addresses are bracketed and their zone
+// escaped.
+func (m SendModel) URL(path string) string {
+	protocol := m.Protocol
+	if protocol == "" {
+		protocol = "https"
+	}
+	port := m.Port
+	if port == 0 {
+		port = DefaultPort
+	}
+	host := strings.ReplaceAll(m.IP, "%", "%25")
+	return fmt.Sprintf("%s://%s%s", protocol, net.JoinHostPort(host, strconv.Itoa(port)), path)
 }
@@ -0,0 +1,24 @@
+package models
+
+import "testing"
+
+func TestSendModelURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		device SendModel
+		want   string
+	}{
+		{"defaults", SendModel{IP: "192.168.1.2"}, "https://192.168.1.2:53317/api/localsend/v2/info"},
+		{"advertised", SendModel{IP: "192.168.1.2", Port: 8080, Protocol: "http"}, "http://192.168.1.2:8080/api/localsend/v2/info"},
+		{"ipv6", SendModel{IP: "fd00::2", Port: 53317, Protocol: "https"}, "https://[fd00::2]:53317/api/localsend/v2/info"},
+		{"ipv6 loopback", SendModel{IP: "::1", Port: 8080, Protocol: "http"}, "http://[::1]:8080/api/localsend/v2/info"},
+		{"ipv6 zone", SendModel{IP: "fe80::1%eth0", Port: 53317, Protocol: "https"}, "https://[fe80::1%25eth0]:53317/api/localsend/v2/info"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.device.URL("/api/localsend/v2/info"); got != tt.want {
+				t.Fatalf("URL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
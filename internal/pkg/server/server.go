@@ -1,7 +1,138 @@
 package server
 
-import "net/http"
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiPrefix     = "/api/localsend/" // Paths of the LocalSend API
+	sniffTimeout  = 10 * time.Second  // Time a client has to send its first byte
+	tlsRecordType = 0x16              // First byte of a TLS handshake
+)
 
 func New() *http.ServeMux {
 	return http.NewServeMux()
 }
+
+// ListenAndServe serves handler on addr, see Serve
+func ListenAndServe(addr string, handler http.Handler, cert *tls.Certificate) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return Serve(ln, handler, cert)
+}
+
+// Serve serves handler on ln. When cert is not nil, the LocalSend API is only
+// served over TLS, while plain HTTP connections on the same port still reach
+// everything else, so browsers can use the web file server without a
+// certificate warning.
+func Serve(ln net.Listener, handler http.Handler, cert *tls.Certificate) error {
+	if cert == nil {
+		return http.Serve(ln, handler)
+	}
+
+	tlsLn, plainLn := newChanListener(ln.Addr()), newChanListener(ln.Addr())
+	defer tlsLn.Close()
+	defer plainLn.Close()
+
+	secure := &http.Server{
+		Handler:   handler,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{*cert}},
+	}
+	plain := &http.Server{Handler: plainOnly(handler)}
+	go secure.ServeTLS(tlsLn, "", "")
+	go plain.Serve(plainLn)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			// Sort the connection by its first byte, without blocking Accept
+			conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+			r := bufio.NewReader(conn)
+			first, err := r.Peek(1)
+			conn.SetReadDeadline(time.Time{})
+			if err != nil {
+				conn.Close()
+				return
+			}
+			peeked := &peekedConn{Conn: conn, r: r}
+			if first[0] == tlsRecordType {
+				tlsLn.push(peeked)
+			} else {
+				plainLn.push(peeked)
+			}
+		}()
+	}
+}
+
+// plainOnly rejects LocalSend API requests made over plain HTTP, the way
+// net/http answers plain requests to an HTTPS server
+func plainOnly(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, apiPrefix) {
+			http.Error(w, "Client sent an HTTP request to an HTTPS server.", http.StatusBadRequest)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// peekedConn is a connection whose first bytes were already read into r
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// chanListener is a net.Listener fed with connections accepted elsewhere
+type chanListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newChanListener(addr net.Addr) *chanListener {
+	return &chanListener{addr: addr, conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+// push hands conn to the listener's server, closing it if the listener is
+// closed
+func (l *chanListener) push(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *chanListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *chanListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *chanListener) Addr() net.Addr {
+	return l.addr
+}
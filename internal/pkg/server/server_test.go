@@ -0,0 +1,52 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+)
+
+// TestServeSplitsProtocols checks that with a certificate the LocalSend API is
+// only served over HTTPS, while the web file server stays on plain HTTP
+func TestServeSplitsProtocols(t *testing.T) {
+	cert, err := LoadCertificate("", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadCertificate: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	mux := New()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	go Serve(ln, mux, &cert)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	addr := ln.Addr().String()
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{"https://" + addr + "/api/localsend/v2/info", http.StatusOK},
+		{"https://" + addr + "/", http.StatusOK},
+		{"http://" + addr + "/", http.StatusOK},
+		{"http://" + addr + "/uploads/", http.StatusOK},
+		{"http://" + addr + "/api/localsend/v2/info", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, err := client.Get(tt.url)
+		if err != nil {
+			t.Errorf("GET %s: %v", tt.url, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("GET %s: status = %d, want %d", tt.url, resp.StatusCode, tt.want)
+		}
+	}
+}
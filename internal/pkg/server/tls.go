@@ -0,0 +1,87 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+const (
+	generatedCertFile = "localsend-cert.pem"
+	generatedKeyFile  = "localsend-key.pem"
+	certValidity      = 10 * 365 * 24 * time.Hour
+)
+
+// LoadCertificate loads the TLS certificate used by the API server. When
+// certFile and keyFile are empty, a self-signed pair stored in dir is used and
+// generated on first run.
+func LoadCertificate(certFile, keyFile, dir string) (tls.Certificate, error) {
+	if certFile != "" && keyFile != "" {
+		return tls.LoadX509KeyPair(certFile, keyFile)
+	}
+
+	certFile = filepath.Join(dir, generatedCertFile)
+	keyFile = filepath.Join(dir, generatedKeyFile)
+
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if errors.Is(certErr, os.ErrNotExist) || errors.Is(keyErr, os.ErrNotExist) {
+		logger.Info("Generating self-signed TLS certificate in ", dir)
+		if err := generateCertificate(certFile, keyFile); err != nil {
+			return tls.Certificate{}, fmt.Errorf("error generating certificate: %w", err)
+		}
+	}
+
+	return tls.LoadX509KeyPair(certFile, keyFile)
+}
+
+// generateCertificate creates a self-signed RSA certificate like the one the
+// official LocalSend apps use and writes it as PEM
+func generateCertificate(certFile, keyFile string) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "LocalSend User"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0o755); err != nil {
+		return err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return os.WriteFile(keyFile, keyPEM, 0o600)
+}
@@ -0,0 +1,255 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// Errors returned by the session manager, mapped to HTTP status codes by the
+// handlers (409 and 403 respectively)
+var (
+	ErrBlocked   = errors.New("blocked by another session")
+	ErrForbidden = errors.New("invalid session, token or IP address")
+)
+
+// File is a single file announced in prepare-upload
+type File struct {
+	Info      models.FileInfo
+	Token     string
+	Done      bool
+	Overwrite bool // Replace an existing file instead of saving under a new name
+}
+
+// Session is a receive session created by prepare-upload. Only one session
+// can be active at a time, as required by the LocalSend protocol.
+type Session struct {
+	ID       string
+	SenderIP string
+	Sender   models.Info
+	Files    map[string]*File
+
+	ctx          context.Context
+	cancel       context.CancelFunc
+	uploading    int       // Number of uploads in progress
+	lastActivity time.Time // Used to expire abandoned sessions
+}
+
+// Context is cancelled when the session is closed, cancelled or expires
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// Manager keeps track of the active receive session
+type Manager struct {
+	mu      sync.Mutex
+	active  *Session
+	timeout time.Duration
+}
+
+// NewManager creates a manager whose sessions expire after being idle for
+// timeout
+func NewManager(timeout time.Duration) *Manager {
+	return &Manager{timeout: timeout}
+}
+
+// Create starts a new session for the given sender and files, generating a
+// random token per file. It returns ErrBlocked while another session is active.
+func (m *Manager) Create(senderIP string, sender models.Info, files map[string]models.FileInfo) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expireLocked(time.Now())
+	if m.active != nil {
+		return nil, ErrBlocked
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Session{
+		ID:           id,
+		SenderIP:     senderIP,
+		Sender:       sender,
+		Files:        make(map[string]*File, len(files)),
+		ctx:          ctx,
+		cancel:       cancel,
+		lastActivity: time.Now(),
+	}
+	for fileID, info := range files {
+		token, err := randomToken()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		s.Files[fileID] = &File{Info: info, Token: token}
+	}
+
+	m.active = s
+	return s, nil
+}
+
+// Tokens returns the file ID to token map sent back to the sender
+func (s *Session) Tokens() map[string]string {
+	tokens := make(map[string]string, len(s.Files))
+	for fileID, file := range s.Files {
+		tokens[fileID] = file.Token
+	}
+	return tokens
+}
+
+// Retain keeps only the given files in the session, e.g. after the user
+// accepted a subset. It reports whether the session is still active.
+func (m *Manager) Retain(sessionID string, fileIDs []string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.active
+	if s == nil || s.ID != sessionID {
+		return false
+	}
+
+	keep := make(map[string]bool, len(fileIDs))
+	for _, id := range fileIDs {
+		keep[id] = true
+	}
+	for id := range s.Files {
+		if !keep[id] {
+			delete(s.Files, id)
+		}
+	}
+	s.lastActivity = time.Now()
+	return true
+}
+
+// SetOverwrite marks the given files as replacing an existing file instead of
+// being saved under a new name. It reports whether the session is still
+// active.
+func (m *Manager) SetOverwrite(sessionID string, fileIDs []string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.active
+	if s == nil || s.ID != sessionID {
+		return false
+	}
+
+	for _, id := range fileIDs {
+		if file, ok := s.Files[id]; ok {
+			file.Overwrite = true
+		}
+	}
+	s.lastActivity = time.Now()
+	return true
+}
+
+// StartUpload validates an upload request and marks it in progress. Every
+// successful call must be followed by FinishUpload.
+func (m *Manager) StartUpload(sessionID, fileID, token, ip string) (*Session, *File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expireLocked(time.Now())
+	s := m.active
+	if s == nil {
+		return nil, nil, ErrForbidden
+	}
+	if s.ID != sessionID {
+		return nil, nil, ErrBlocked
+	}
+
+	file, ok := s.Files[fileID]
+	if !ok || file.Done || file.Token != token || s.SenderIP != ip {
+		return nil, nil, ErrForbidden
+	}
+
+	s.uploading++
+	s.lastActivity = time.Now()
+	return s, file, nil
+}
+
+// FinishUpload ends an upload started by StartUpload. Completed files are
+// marked as done and the session is closed once all files are received.
+func (m *Manager) FinishUpload(sessionID, fileID string, completed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.active
+	if s == nil || s.ID != sessionID {
+		return
+	}
+
+	s.uploading--
+	s.lastActivity = time.Now()
+	if file, ok := s.Files[fileID]; ok && completed {
+		file.Done = true
+	}
+
+	for _, file := range s.Files {
+		if !file.Done {
+			return
+		}
+	}
+	logger.Debugf("All files of session %s received", s.ID)
+	m.closeLocked()
+}
+
+// Cancel closes the session with the given ID. It reports whether the session
+// was active.
+func (m *Manager) Cancel(sessionID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.active == nil || m.active.ID != sessionID {
+		return false
+	}
+	m.closeLocked()
+	return true
+}
+
+// StartCleanup periodically removes expired sessions
+func (m *Manager) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			m.mu.Lock()
+			m.expireLocked(now)
+			m.mu.Unlock()
+		}
+	}()
+}
+
+// expireLocked closes the active session when it has been idle for longer than
+// the timeout. Callers must hold m.mu.
+func (m *Manager) expireLocked(now time.Time) {
+	s := m.active
+	if s == nil || s.uploading > 0 || now.Sub(s.lastActivity) < m.timeout {
+		return
+	}
+	logger.Infof("Session %s expired", s.ID)
+	m.closeLocked()
+}
+
+// closeLocked closes the active session. Callers must hold m.mu.
+func (m *Manager) closeLocked() {
+	m.active.cancel()
+	m.active = nil
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
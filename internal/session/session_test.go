@@ -0,0 +1,108 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func newTestSession(t *testing.T, m *Manager) *Session {
+	t.Helper()
+	s, err := m.Create("192.168.1.2", models.Info{Alias: "Sender"}, map[string]models.FileInfo{
+		"a": {ID: "a", FileName: "a.txt"},
+		"b": {ID: "b", FileName: "b.txt"},
+	})
+	if err != nil {
+		t.Fatalf("Create returned an error: %v", err)
+	}
+	return s
+}
+
+func TestCreateBlocksWhileActive(t *testing.T) {
+	m := NewManager(time.Minute)
+	newTestSession(t, m)
+
+	if _, err := m.Create("192.168.1.3", models.Info{}, nil); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("expected ErrBlocked, got %v", err)
+	}
+}
+
+func TestStartUploadValidation(t *testing.T) {
+	m := NewManager(time.Minute)
+	s := newTestSession(t, m)
+	token := s.Files["a"].Token
+
+	tests := []struct {
+		name      string
+		sessionID string
+		fileID    string
+		token     string
+		ip        string
+		want      error
+	}{
+		{"valid", s.ID, "a", token, "192.168.1.2", nil},
+		{"other session", "other", "a", token, "192.168.1.2", ErrBlocked},
+		{"wrong token", s.ID, "a", "bad", "192.168.1.2", ErrForbidden},
+		{"token of other file", s.ID, "b", token, "192.168.1.2", ErrForbidden},
+		{"wrong ip", s.ID, "a", token, "192.168.1.9", ErrForbidden},
+		{"unknown file", s.ID, "c", token, "192.168.1.2", ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := m.StartUpload(tt.sessionID, tt.fileID, tt.token, tt.ip)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if err == nil {
+				m.FinishUpload(tt.sessionID, tt.fileID, false)
+			}
+		})
+	}
+}
+
+func TestSetOverwrite(t *testing.T) {
+	m := NewManager(time.Minute)
+	s := newTestSession(t, m)
+
+	if !m.SetOverwrite(s.ID, []string{"a", "unknown"}) {
+		t.Fatal("SetOverwrite reported an inactive session")
+	}
+	_, file, err := m.StartUpload(s.ID, "a", s.Files["a"].Token, s.SenderIP)
+	if err != nil {
+		t.Fatalf("StartUpload returned an error: %v", err)
+	}
+	m.FinishUpload(s.ID, "a", false)
+	if !file.Overwrite || s.Files["b"].Overwrite {
+		t.Fatalf("overwrite flags: a=%v b=%v", file.Overwrite, s.Files["b"].Overwrite)
+	}
+
+	if m.SetOverwrite("other", []string{"b"}) {
+		t.Fatal("SetOverwrite accepted another session's ID")
+	}
+}
+
+func TestSessionClosesWhenAllFilesDone(t *testing.T) {
+	m := NewManager(time.Minute)
+	s := newTestSession(t, m)
+
+	for id, file := range s.Files {
+		if _, _, err := m.StartUpload(s.ID, id, file.Token, s.SenderIP); err != nil {
+			t.Fatalf("StartUpload returned an error: %v", err)
+		}
+		m.FinishUpload(s.ID, id, true)
+	}
+
+	if s.Context().Err() == nil {
+		t.Fatal("expected session context to be cancelled")
+	}
+	newTestSession(t, m)
+}
+
+func TestIdleSessionExpires(t *testing.T) {
+	m := NewManager(time.Millisecond)
+	newTestSession(t, m)
+	time.Sleep(5 * time.Millisecond)
+	newTestSession(t, m)
+}
@@ -0,0 +1,164 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/models"
+
+	bubbletea "github.com/charmbracelet/bubbletea"
+)
+
+// ConfirmTransfer asks the user which of the incoming files to accept. It
+// returns the accepted file IDs (empty when rejected) and whether the prompt
+// timed out without an answer.
+func ConfirmTransfer(sender models.Info, files map[string]models.FileInfo, timeout time.Duration) ([]string, bool, error) {
+	title := fmt.Sprintf("%s (%s) wants to send you %d file(s):", sender.Alias, sender.DeviceModel, len(files))
+	return SelectFiles(title, files, timeout)
+}
+
+// SelectFiles shows a checklist of files with all of them selected. It
+// returns the selected file IDs (empty when rejected) and whether the prompt
+// timed out. A zero timeout waits forever.
+func SelectFiles(title string, files map[string]models.FileInfo, timeout time.Duration) ([]string, bool, error) {
+	ids := make([]string, 0, len(files))
+	for id := range files {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return files[ids[i]].FileName < files[ids[j]].FileName
+	})
+
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	initModel := confirmModel{
+		title:    title,
+		files:    files,
+		ids:      ids,
+		selected: selected,
+	}
+	if timeout > 0 {
+		initModel.deadline = time.Now().Add(timeout)
+	}
+
+	cmd := bubbletea.NewProgram(initModel)
+	m, err := cmd.Run()
+	if err != nil {
+		return nil, false, err
+	}
+
+	result := m.(confirmModel)
+	if result.timedOut {
+		return nil, true, nil
+	}
+	if !result.accepted {
+		return nil, false, nil
+	}
+
+	accepted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if result.selected[id] {
+			accepted = append(accepted, id)
+		}
+	}
+	return accepted, false, nil
+}
+
+// confirmModel is the Bubble Tea model of the accept/decline prompt
+type confirmModel struct {
+	title    string
+	files    map[string]models.FileInfo
+	ids      []string // File IDs in display order
+	selected map[string]bool
+	cursor   int
+	deadline time.Time // Zero when the prompt never times out
+	accepted bool
+	timedOut bool
+}
+
+// Init implements the Bubble Tea Init method
+func (m confirmModel) Init() bubbletea.Cmd {
+	return tick()
+}
+
+// Update implements the Bubble Tea Update method
+func (m confirmModel) Update(msg bubbletea.Msg) (bubbletea.Model, bubbletea.Cmd) {
+	switch msg := msg.(type) {
+	case bubbletea.KeyMsg:
+		switch msg.String() {
+		case "down", "j":
+			m.cursor = (m.cursor + 1) % len(m.ids)
+		case "up", "k":
+			m.cursor = (m.cursor - 1 + len(m.ids)) % len(m.ids)
+		case " ":
+			id := m.ids[m.cursor]
+			m.selected[id] = !m.selected[id]
+		case "a":
+			for _, id := range m.ids {
+				m.selected[id] = true
+			}
+			m.accepted = true
+			return m, bubbletea.Quit
+		case "enter":
+			m.accepted = true
+			return m, bubbletea.Quit
+		case "r", "n", "q", "ctrl+c":
+			return m, bubbletea.Quit
+		}
+	case TickMsg:
+		if !m.deadline.IsZero() && time.Time(msg).After(m.deadline) {
+			m.timedOut = true
+			return m, bubbletea.Quit
+		}
+		return m, tick()
+	}
+	return m, nil
+}
+
+// View implements the Bubble Tea View method
+func (m confirmModel) View() string {
+	var s strings.Builder
+
+	s.WriteString(m.title + "\n\n")
+	for i, id := range m.ids {
+		cursor := " "
+		if m.cursor == i {
+			cursor = ">"
+		}
+		check := "[ ]"
+		if m.selected[id] {
+			check = "[x]"
+		}
+		file := m.files[id]
+		fmt.Fprintf(&s, "%s %s %s (%s)\n", cursor, check, file.FileName, FormatSize(file.Size))
+	}
+
+	s.WriteString("\nSpace to toggle, enter to accept selected, a to accept all, r to reject")
+	if !m.deadline.IsZero() {
+		remaining := time.Until(m.deadline).Round(time.Second)
+		if remaining < 0 {
+			remaining = 0
+		}
+		fmt.Fprintf(&s, " (%v left)", remaining)
+	}
+	return s.String()
+}
+
+// FormatSize formats a byte count for display
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
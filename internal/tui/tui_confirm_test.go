@@ -0,0 +1,58 @@
+package tui
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/models"
+
+	bubbletea "github.com/charmbracelet/bubbletea"
+)
+
+func newConfirmModel() confirmModel {
+	return confirmModel{
+		title: "Sender (android) wants to send you 2 file(s):",
+		files: map[string]models.FileInfo{
+			"a": {ID: "a", FileName: "a.jpg", Size: 2048},
+			"b": {ID: "b", FileName: "b.jpg", Size: 10},
+		},
+		ids:      []string{"a", "b"},
+		selected: map[string]bool{"a": true, "b": true},
+		deadline: time.Now().Add(time.Minute),
+	}
+}
+
+// TestConfirmModelSelectSubset toggles one file off and accepts the rest
+func TestConfirmModelSelectSubset(t *testing.T) {
+	var m bubbletea.Model = newConfirmModel()
+	m, _ = m.Update(bubbletea.KeyMsg{Type: bubbletea.KeySpace, Runes: []rune(" ")})
+	m, _ = m.Update(bubbletea.KeyMsg{Type: bubbletea.KeyEnter})
+
+	result := m.(confirmModel)
+	if !result.accepted {
+		t.Fatal("expected transfer to be accepted")
+	}
+	if result.selected["a"] || !result.selected["b"] {
+		t.Fatalf("unexpected selection: %v", result.selected)
+	}
+}
+
+// TestConfirmModelReject rejects the transfer
+func TestConfirmModelReject(t *testing.T) {
+	var m bubbletea.Model = newConfirmModel()
+	m, _ = m.Update(bubbletea.KeyMsg{Type: bubbletea.KeyRunes, Runes: []rune("r")})
+
+	if m.(confirmModel).accepted {
+		t.Fatal("expected transfer to be rejected")
+	}
+}
+
+// TestConfirmModelTimeout applies the default action once the deadline passes
+func TestConfirmModelTimeout(t *testing.T) {
+	var m bubbletea.Model = newConfirmModel()
+	m, _ = m.Update(TickMsg(time.Now().Add(2 * time.Minute)))
+
+	if !m.(confirmModel).timedOut {
+		t.Fatal("expected prompt to time out")
+	}
+}
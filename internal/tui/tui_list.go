@@ -2,15 +2,18 @@ package tui
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/meowrain/localsend-go/internal/models"
 
 	bubbletea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 )
 
 // SelectDevice displays a selectable device list using Bubble Tea and waits for user selection
-func SelectDevice(updates <-chan []models.SendModel) (string, error) {
+func SelectDevice(updates <-chan []models.SendModel) (models.SendModel, error) {
 	// Create a buffered internal channel
 	internalUpdates := make(chan []models.SendModel, 100)
 
@@ -36,6 +39,7 @@ func SelectDevice(updates <-chan []models.SendModel) (string, error) {
 		devices:    []models.SendModel{},
 		deviceMap:  make(map[string]models.SendModel),
 		sortedKeys: make([]string, 0),
+		gone:       make(map[string]bool),
 		cursor:     0,
 		updates:    internalUpdates,
 	}
@@ -43,20 +47,24 @@ func SelectDevice(updates <-chan []models.SendModel) (string, error) {
 	cmd := bubbletea.NewProgram(initModel)
 	m, err := cmd.Run()
 	if err != nil {
-		return "", err
+		return models.SendModel{}, err
 	}
 
-	if m, ok := m.(model); ok && len(m.devices) > 0 {
-		return m.devices[m.cursor].IP, nil
+	if m, ok := m.(model); ok && len(m.devices) > 0 && !m.gone[m.devices[m.cursor].IP] {
+		return m.devices[m.cursor], nil
 	}
-	return "", nil
+	return models.SendModel{}, nil
 }
 
+// goneStyle greys out devices that are no longer seen on the network
+var goneStyle = lipgloss.NewStyle().Faint(true)
+
 // model is the Bubble Tea model
 type model struct {
 	devices    []models.SendModel
 	deviceMap  map[string]models.SendModel // Uses IP as key to store devices
 	sortedKeys []string                    // Maintains a fixed display order
+	gone       map[string]bool             // Devices that vanished from the network
 	cursor     int
 	updates    <-chan []models.SendModel
 }
@@ -92,6 +100,9 @@ func (m model) Update(msg bubbletea.Msg) (bubbletea.Model, bubbletea.Cmd) {
 				m.cursor = (m.cursor - 1 + len(m.devices)) % len(m.devices) // Move up
 			}
 		case "enter":
+			if len(m.devices) > 0 && m.gone[m.devices[m.cursor].IP] {
+				return m, nil // Vanished devices can't be selected
+			}
 			return m, bubbletea.Quit // Confirm selection
 		}
 	case TickMsg:
@@ -100,26 +111,58 @@ func (m model) Update(msg bubbletea.Msg) (bubbletea.Model, bubbletea.Cmd) {
 			if m.deviceMap == nil {
 				m.deviceMap = make(map[string]models.SendModel)
 			}
+			if m.gone == nil {
+				m.gone = make(map[string]bool)
+			}
 
 			// Update device map
 			changed := false
+			present := make(map[string]bool, len(newDevices))
 			for _, device := range newDevices {
-				if _, exists := m.deviceMap[device.IP]; !exists {
-					m.deviceMap[device.IP] = device
+				present[device.IP] = true
+				existing, exists := m.deviceMap[device.IP]
+				if !exists {
 					m.sortedKeys = append(m.sortedKeys, device.IP)
+				}
+				if !exists || existing != device || m.gone[device.IP] {
+					m.deviceMap[device.IP] = device
+					delete(m.gone, device.IP)
+					changed = true
+				}
+			}
+
+			// Each update is the full device list, so missing devices vanished
+			for _, key := range m.sortedKeys {
+				if !present[key] && !m.gone[key] {
+					m.gone[key] = true
 					changed = true
 				}
 			}
 
-			// Only update the device list when new devices are found
+			// Only update the device list when devices are added or changed
 			if changed {
+				selected := ""
+				if m.cursor < len(m.devices) {
+					selected = m.devices[m.cursor].IP
+				}
+
 				m.devices = make([]models.SendModel, 0, len(m.deviceMap))
 				for _, key := range m.sortedKeys {
 					if device, ok := m.deviceMap[key]; ok {
 						m.devices = append(m.devices, device)
 					}
 				}
+				// Group by device type, keeping the discovery order within a group
+				sort.SliceStable(m.devices, func(i, j int) bool {
+					return typeRank(m.devices[i].DeviceType) < typeRank(m.devices[j].DeviceType)
+				})
 
+				// Keep the cursor on the same device when others are inserted
+				for i, device := range m.devices {
+					if device.IP == selected {
+						m.cursor = i
+					}
+				}
 				// Ensure cursor doesn't exceed device list bounds
 				if m.cursor >= len(m.devices) {
 					m.cursor = len(m.devices) - 1
@@ -132,19 +175,90 @@ func (m model) Update(msg bubbletea.Msg) (bubbletea.Model, bubbletea.Cmd) {
 	return m, nil
 }
 
+// deviceTypes lists the LocalSend device types in display order
+var deviceTypes = []string{"mobile", "desktop", "web", "headless", "server"}
+
+// typeRank returns the display position of a device type's group. Unknown
+// types come last.
+func typeRank(deviceType string) int {
+	for i, t := range deviceTypes {
+		if strings.EqualFold(t, deviceType) {
+			return i
+		}
+	}
+	return len(deviceTypes)
+}
+
+// groupTitle returns the heading of a device type's group
+func groupTitle(deviceType string) string {
+	if typeRank(deviceType) == len(deviceTypes) {
+		return "Other"
+	}
+	deviceType = strings.ToLower(deviceType)
+	return strings.ToUpper(deviceType[:1]) + deviceType[1:]
+}
+
+// shortFingerprint returns the first characters of a fingerprint, enough to
+// tell devices with the same alias apart
+func shortFingerprint(fingerprint string) string {
+	if len(fingerprint) > 8 {
+		return fingerprint[:8]
+	}
+	return fingerprint
+}
+
+// formatAge describes how long ago a device was last seen
+func formatAge(lastSeen time.Time) string {
+	if lastSeen.IsZero() {
+		return ""
+	}
+	age := time.Since(lastSeen)
+	switch {
+	case age < 5*time.Second:
+		return "just now"
+	case age < time.Minute:
+		return fmt.Sprintf("%ds ago", int(age.Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm ago", int(age.Minutes()))
+	default:
+		return fmt.Sprintf("%dh ago", int(age.Hours()))
+	}
+}
+
 // View implements the Bubble Tea View method
 func (m model) View() string {
 	if len(m.devices) == 0 {
 		return "Scanning Devices...\n\n Press Ctrl+C to exit"
 	}
 
-	s := "Found Devices:\n\n"
+	// Align the columns
+	nameWidth, modelWidth, ipWidth := 0, 0, 0
+	for _, device := range m.devices {
+		nameWidth = max(nameWidth, lipgloss.Width(device.DeviceName))
+		modelWidth = max(modelWidth, lipgloss.Width(device.DeviceModel))
+		ipWidth = max(ipWidth, len(device.IP))
+	}
+
+	s := "Found Devices:\n"
 	for i, device := range m.devices {
+		if i == 0 || typeRank(device.DeviceType) != typeRank(m.devices[i-1].DeviceType) {
+			s += "\n" + groupTitle(device.DeviceType) + "\n"
+		}
+
 		cursor := " " // No cursor by default
 		if m.cursor == i {
 			cursor = ">" // Selected cursor
 		}
-		s += fmt.Sprintf("%s %s (%s)\n", cursor, device.DeviceName, device.IP)
+		line := fmt.Sprintf("%s %-*s  %-*s  %-*s  %-8s  %s", cursor,
+			nameWidth, device.DeviceName, modelWidth, device.DeviceModel,
+			ipWidth, device.IP, shortFingerprint(device.Fingerprint), formatAge(device.LastSeen))
+		if device.Static {
+			line += " [static]"
+		}
+		if m.gone[device.IP] {
+			line = goneStyle.Render(line + " - offline")
+		}
+		s += line + "\n"
 	}
 	s += "\nUse arrow keys to navigate and enter to select. Press Ctrl+C to exit."
 	return s
@@ -1,10 +1,13 @@
 package tui
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/meowrain/localsend-go/internal/models"
+
+	bubbletea "github.com/charmbracelet/bubbletea"
 )
 
 // TestSelectDevice tests the SelectDevice function
@@ -28,7 +31,7 @@ func TestSelectDevice(t *testing.T) {
 	}()
 
 	// Call the SelectDevice function
-	ip, err := SelectDevice(updates)
+	device, err := SelectDevice(updates)
 	if err != nil {
 		t.Fatalf("SelectDevice returned an error: %v", err)
 	}
@@ -39,7 +42,103 @@ func TestSelectDevice(t *testing.T) {
 		"192.168.1.2": true,
 		"192.168.1.3": true,
 	}
-	if !expectedIPs[ip] {
-		t.Fatalf("SelectDevice returned an unexpected IP: %s", ip)
+	if !expectedIPs[device.IP] {
+		t.Fatalf("SelectDevice returned an unexpected IP: %s", device.IP)
+	}
+}
+
+// TestModelMarksVanishedDevices checks that devices missing from an update are
+// greyed out and can't be selected until they come back
+func TestModelMarksVanishedDevices(t *testing.T) {
+	updates := make(chan []models.SendModel, 3)
+	var m bubbletea.Model = model{updates: updates}
+
+	updates <- []models.SendModel{
+		{IP: "192.168.1.1", DeviceName: "Device 1"},
+		{IP: "192.168.1.2", DeviceName: "Device 2"},
+	}
+	m, _ = m.Update(TickMsg(time.Now()))
+	updates <- []models.SendModel{
+		{IP: "192.168.1.2", DeviceName: "Device 2"},
+	}
+	m, _ = m.Update(TickMsg(time.Now()))
+
+	state := m.(model)
+	if len(state.devices) != 2 || !state.gone["192.168.1.1"] || state.gone["192.168.1.2"] {
+		t.Fatalf("unexpected state: devices=%+v gone=%v", state.devices, state.gone)
+	}
+
+	// The cursor is on the vanished device, so enter must not confirm it
+	if _, cmd := m.Update(bubbletea.KeyMsg{Type: bubbletea.KeyEnter}); cmd != nil {
+		t.Fatal("vanished device was selectable")
+	}
+
+	updates <- []models.SendModel{
+		{IP: "192.168.1.1", DeviceName: "Device 1"},
+		{IP: "192.168.1.2", DeviceName: "Device 2"},
+	}
+	m, _ = m.Update(TickMsg(time.Now()))
+	if m.(model).gone["192.168.1.1"] {
+		t.Fatal("device that came back is still marked as gone")
+	}
+}
+
+// TestModelGroupsDevicesByType checks that devices are grouped by type and
+// that the cursor stays on its device when another one is inserted before it
+func TestModelGroupsDevicesByType(t *testing.T) {
+	updates := make(chan []models.SendModel, 2)
+	var m bubbletea.Model = model{updates: updates}
+
+	updates <- []models.SendModel{
+		{IP: "192.168.1.1", DeviceName: "Server", DeviceType: "headless"},
+		{IP: "192.168.1.2", DeviceName: "Laptop", DeviceType: "desktop"},
+	}
+	m, _ = m.Update(TickMsg(time.Now()))
+	m, _ = m.Update(bubbletea.KeyMsg{Type: bubbletea.KeyDown})
+	if state := m.(model); state.devices[state.cursor].IP != "192.168.1.1" {
+		t.Fatalf("cursor on %s, want 192.168.1.1", state.devices[state.cursor].IP)
+	}
+
+	updates <- []models.SendModel{
+		{IP: "192.168.1.1", DeviceName: "Server", DeviceType: "headless"},
+		{IP: "192.168.1.2", DeviceName: "Laptop", DeviceType: "desktop"},
+		{IP: "192.168.1.3", DeviceName: "Phone", DeviceType: "mobile"},
+		{IP: "192.168.1.4", DeviceName: "Toaster", DeviceType: "toaster"},
+	}
+	m, _ = m.Update(TickMsg(time.Now()))
+
+	state := m.(model)
+	var order []string
+	for _, device := range state.devices {
+		order = append(order, device.DeviceName)
+	}
+	if strings.Join(order, ",") != "Phone,Laptop,Server,Toaster" {
+		t.Fatalf("device order = %v", order)
+	}
+	if state.devices[state.cursor].IP != "192.168.1.1" {
+		t.Fatalf("cursor moved to %s", state.devices[state.cursor].IP)
+	}
+
+	view := state.View()
+	for _, title := range []string{"Mobile", "Desktop", "Headless", "Other"} {
+		if !strings.Contains(view, title+"\n") {
+			t.Errorf("view has no %q group:\n%s", title, view)
+		}
+	}
+}
+
+// TestViewTellsSameAliasApart checks that two devices with the same alias are
+// shown with their model, address and fingerprint
+func TestViewTellsSameAliasApart(t *testing.T) {
+	m := model{devices: []models.SendModel{
+		{IP: "192.168.1.1", DeviceName: "Phone", DeviceType: "mobile", DeviceModel: "Pixel", Fingerprint: "aaaaaaaa11111111", LastSeen: time.Now()},
+		{IP: "192.168.1.2", DeviceName: "Phone", DeviceType: "mobile", DeviceModel: "iPhone", Fingerprint: "bbbbbbbb22222222", LastSeen: time.Now().Add(-2 * time.Minute)},
+	}}
+
+	view := m.View()
+	for _, want := range []string{"Pixel", "iPhone", "192.168.1.1", "192.168.1.2", "aaaaaaaa ", "bbbbbbbb ", "just now", "2m ago"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view does not contain %q:\n%s", want, view)
+		}
 	}
 }
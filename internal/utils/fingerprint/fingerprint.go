@@ -0,0 +1,53 @@
+package fingerprint
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const idFile = "localsend-fingerprint"
+
+// FromCertificate returns the SHA-256 hash of the leaf certificate, which is
+// how LocalSend identifies devices when HTTPS is enabled
+func FromCertificate(cert tls.Certificate) string {
+	if len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadOrCreate returns the random device ID stored in dir, generating and
+// persisting a new one on first run. Used when HTTPS is disabled.
+func LoadOrCreate(dir string) (string, error) {
+	path := filepath.Join(dir, idFile)
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(id+"\n"), 0o644); err != nil {
+		return "", err
+	}
+	return id, nil
+}
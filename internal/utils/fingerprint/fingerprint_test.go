@@ -0,0 +1,23 @@
+package fingerprint
+
+import "testing"
+
+func TestLoadOrCreateIsStable(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := LoadOrCreate(dir)
+	if err != nil {
+		t.Fatalf("LoadOrCreate returned an error: %v", err)
+	}
+	if first == "" {
+		t.Fatal("LoadOrCreate returned an empty fingerprint")
+	}
+
+	second, err := LoadOrCreate(dir)
+	if err != nil {
+		t.Fatalf("LoadOrCreate returned an error: %v", err)
+	}
+	if first != second {
+		t.Fatalf("fingerprint changed across loads: %s != %s", first, second)
+	}
+}
@@ -0,0 +1,83 @@
+// Package safepath turns file names received from peers into paths that
+// stay inside the directory they are saved to.
+package safepath
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrEmpty    = errors.New("empty file name")
+	ErrAbsolute = errors.New("absolute file name")
+	ErrEscapes  = errors.New("file name escapes the target directory")
+)
+
+// reservedNames are device names Windows won't create files with, with or
+// without an extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Clean sanitizes a relative file name sent by a peer and returns it with
+// the native separator. Both / and \ separate directories. Control
+// characters are removed, as are trailing dots and spaces of each element,
+// and reserved device names get a "_" prefix. Absolute names and names that
+// leave the target directory through ".." are rejected.
+func Clean(name string) (string, error) {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.ReplaceAll(name, `\`, "/")
+
+	if strings.HasPrefix(name, "/") || hasDriveLetter(name) {
+		return "", ErrAbsolute
+	}
+
+	elements := strings.Split(name, "/")
+	for i, element := range elements {
+		if element == "." || element == ".." {
+			continue
+		}
+		element = strings.TrimRight(element, ". ")
+		base, _, _ := strings.Cut(element, ".")
+		if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+			element = "_" + element
+		}
+		elements[i] = element
+	}
+
+	cleaned := path.Clean(strings.Join(elements, "/"))
+	switch {
+	case cleaned == "." || cleaned == "":
+		return "", ErrEmpty
+	case cleaned == ".." || strings.HasPrefix(cleaned, "../"):
+		return "", ErrEscapes
+	}
+	return filepath.FromSlash(cleaned), nil
+}
+
+// Join sanitizes name with Clean and joins it to dir
+func Join(dir, name string) (string, error) {
+	cleaned, err := Clean(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, cleaned), nil
+}
+
+// hasDriveLetter reports whether name starts with a Windows drive, like "C:"
+func hasDriveLetter(name string) bool {
+	return len(name) >= 2 && name[1] == ':' &&
+		(name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z')
+}
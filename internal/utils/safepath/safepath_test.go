@@ -0,0 +1,74 @@
+package safepath
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{"photo.jpg", "photo.jpg", nil},
+		{"photos/2024/a.jpg", "photos/2024/a.jpg", nil},
+		{`photos\2024\a.jpg`, "photos/2024/a.jpg", nil},
+		{"photos//./a.jpg", "photos/a.jpg", nil},
+		{"photos/../a.jpg", "a.jpg", nil},
+		{"my:file.txt", "my:file.txt", nil},
+
+		// Control characters, trailing dots and spaces
+		{"bad\x00name\n.txt", "badname.txt", nil},
+		{"folder. /file.txt ", "folder/file.txt", nil},
+		{"\x1b[31mred.txt", "[31mred.txt", nil},
+
+		// Reserved device names
+		{"CON", "_CON", nil},
+		{"docs/nul.txt", "docs/_nul.txt", nil},
+		{"com1/a.txt", "_com1/a.txt", nil},
+		{"console.txt", "console.txt", nil},
+
+		// Absolute names
+		{"/etc/passwd", "", ErrAbsolute},
+		{`\Windows\win.ini`, "", ErrAbsolute},
+		{"C:/Windows/win.ini", "", ErrAbsolute},
+		{`c:\a.txt`, "", ErrAbsolute},
+		{`\\server\share\a.txt`, "", ErrAbsolute},
+
+		// Escaping names
+		{"../../.bashrc", "", ErrEscapes},
+		{`..\..\.bashrc`, "", ErrEscapes},
+		{"a/../../b", "", ErrEscapes},
+		{"..", "", ErrEscapes},
+
+		// Empty names
+		{"", "", ErrEmpty},
+		{".", "", ErrEmpty},
+		{"a/..", "", ErrEmpty},
+		{"\x00\x01", "", ErrEmpty},
+	}
+
+	for _, tt := range tests {
+		got, err := Clean(tt.name)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Clean(%q) error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != filepath.FromSlash(tt.want) {
+			t.Errorf("Clean(%q) = %q, want %q", tt.name, got, filepath.FromSlash(tt.want))
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	dir := filepath.Join("srv", "uploads")
+	got, err := Join(dir, "a/b.txt")
+	if err != nil || got != filepath.Join(dir, "a", "b.txt") {
+		t.Errorf("Join = %q, %v", got, err)
+	}
+	if _, err := Join(dir, "../b.txt"); !errors.Is(err, ErrEscapes) {
+		t.Errorf("Join escaped the directory: %v", err)
+	}
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 
@@ -18,6 +22,7 @@ import (
 	"github.com/meowrain/localsend-go/internal/discovery/shared"
 	"github.com/meowrain/localsend-go/internal/handlers"
 	"github.com/meowrain/localsend-go/internal/pkg/server"
+	"github.com/meowrain/localsend-go/internal/utils/fingerprint"
 	"github.com/meowrain/localsend-go/internal/utils/logger"
 	"github.com/meowrain/localsend-go/static"
 	qrcode "github.com/skip2/go-qrcode"
@@ -324,18 +329,24 @@ func WebServerMode(httpServer *http.ServeMux, port int) {
 		httpServer.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(static.EmbeddedStaticFiles))))
 		httpServer.HandleFunc("/send", handlers.NormalSendHandler) // Upload handler
 	}
-	ips, _ := discovery.GetLocalIP()
+	ipNets, _ := discovery.GetLocalIP()
 	localIP := ""
-	for _, ip := range ips {
+	for _, ipNet := range ipNets {
+		ip := ipNet.IP
 		ipStr := ip.String()
 		if strings.HasPrefix(ipStr, "10.") || strings.HasPrefix(ipStr, "192.168.") {
-			logger.Infof("If you opened the HTTP file server, you can view your files on %s", fmt.Sprintf("http://%v:%d", ip, port))
+			logger.Infof("If you opened the HTTP file server, you can view your files on http://%s", net.JoinHostPort(ipStr, strconv.Itoa(port)))
 		}
 		if strings.HasPrefix(ipStr, "192.168.") {
 			localIP = ip.String()
 		}
 	}
-	qr, err := qrcode.New(fmt.Sprintf("http://%s:%d", localIP, port), qrcode.Highest)
+	// A specific bind address is the only one the server can be reached on
+	if ip := net.ParseIP(config.ConfigData.BindAddress); ip != nil && !ip.IsUnspecified() {
+		localIP = ip.String()
+	}
+	// The web file server is always reachable over plain HTTP, see server.Serve
+	qr, err := qrcode.New("http://"+net.JoinHostPort(localIP, strconv.Itoa(port)), qrcode.Highest)
 	if err != nil {
 		fmt.Println("Failed to generate QR code:", err)
 		return
@@ -352,18 +363,104 @@ func ReceiveMode() {
 		logger.Errorf("Failed to create uploads directory: %v", err)
 		return
 	}
+	handlers.SetReceivePrompt(config.ConfigData.Receive.Prompt)
 	discovery.ListenAndStartBroadcasts(nil)
 	logger.Info("Waiting to receive files...")
 	select {}
 }
 
-func SendMode(filePath string) {
-	err := handlers.SendFile(filePath)
+func ShareMode(paths []string, pin string) {
+	files, err := handlers.ShareFiles(paths, pin)
+	if err != nil {
+		logger.Errorf("Share failed: %v", err)
+		return
+	}
+	for _, file := range files {
+		logger.Infof("Sharing %s (%d bytes)", file.FileName, file.Size)
+	}
+	discovery.ListenAndStartBroadcasts(nil)
+	logger.Infof("Sharing %d file(s), waiting for downloads...", len(files))
+	select {}
+}
+
+func FetchMode(target string, pin string, all bool) {
+	defer discovery.SaveKnownDevices()
+	err := handlers.FetchFiles(target, pin, all)
+	if err != nil {
+		logger.Errorf("Fetch failed: %v", err)
+	}
+}
+
+func SendMode(filePath string, pin string) {
+	defer discovery.SaveKnownDevices()
+	err := handlers.SendFile(filePath, pin)
 	if err != nil {
 		logger.Errorf("Send failed: %v", err)
 	}
 }
 
+// DevicesMode lists the remembered devices or forgets some of them
+func DevicesMode(args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		devices, err := discovery.LoadKnownDevices()
+		if err != nil {
+			return fmt.Errorf("failed to load known devices: %w", err)
+		}
+		if len(devices) == 0 {
+			fmt.Println("No known devices")
+			return nil
+		}
+		for _, device := range devices {
+			fmt.Printf("%-24s %-28s %-5s %.8s  last seen %s\n", device.Alias,
+				net.JoinHostPort(device.IP, strconv.Itoa(device.Port)), device.Protocol,
+				device.Fingerprint, device.LastSeen.Format("2006-01-02 15:04"))
+		}
+		return nil
+	}
+
+	if args[0] != "forget" {
+		return fmt.Errorf("unknown devices command %q", args[0])
+	}
+	forgetFlags := flag.NewFlagSet("forget", flag.ExitOnError)
+	all := forgetFlags.Bool("all", false, "Forget all known devices")
+	forgetFlags.Parse(args[1:])
+	// Flag parsing stops at the device, so look for a trailing --all too
+	var targets []string
+	for _, arg := range forgetFlags.Args() {
+		if arg == "-all" || arg == "--all" {
+			*all = true
+		} else {
+			targets = append(targets, arg)
+		}
+	}
+
+	target := ""
+	switch {
+	case *all && len(targets) > 0:
+		return errors.New("--all can't be combined with a device")
+	case *all:
+	case len(targets) == 0:
+		return errors.New("need device fingerprint, alias or IP, or --all")
+	case len(targets) > 1:
+		return errors.New("only one device can be forgotten at a time")
+	default:
+		target = targets[0]
+	}
+
+	forgotten, err := discovery.ForgetKnownDevices(target)
+	if err != nil {
+		return fmt.Errorf("failed to forget devices: %w", err)
+	}
+	if len(forgotten) == 0 {
+		fmt.Println("No matching device")
+		return nil
+	}
+	for _, device := range forgotten {
+		fmt.Printf("Forgot %s (%s)\n", device.Alias, device.IP)
+	}
+	return nil
+}
+
 func ExitMode() {
 	fmt.Println("Exiting program...")
 	os.Exit(0)
@@ -379,14 +476,42 @@ func flagParse(httpServer *http.ServeMux, port int, flagOpen *bool) {
 		case "web":
 			WebServerMode(httpServer, port)
 		case "send":
-			if len(args) > 1 {
-				SendMode(args[1])
+			sendFlags := flag.NewFlagSet("send", flag.ExitOnError)
+			pin := sendFlags.String("pin", "", "PIN to use if the receiver requires one")
+			sendFlags.Parse(args[1:])
+			if sendFlags.NArg() > 0 {
+				SendMode(sendFlags.Arg(0), *pin)
 			} else {
 				logger.Error("Need file path")
 				ExitMode()
 			}
 		case "receive":
+			receiveFlags := flag.NewFlagSet("receive", flag.ExitOnError)
+			pin := receiveFlags.String("pin", config.ConfigData.Pin, "PIN required from senders")
+			receiveFlags.Parse(args[1:])
+			config.ConfigData.Pin = *pin
 			ReceiveMode()
+		case "share":
+			shareFlags := flag.NewFlagSet("share", flag.ExitOnError)
+			pin := shareFlags.String("pin", "", "PIN required to download the shared files")
+			shareFlags.Parse(args[1:])
+			if shareFlags.NArg() > 0 {
+				ShareMode(shareFlags.Args(), *pin)
+			} else {
+				logger.Error("Need file path")
+				ExitMode()
+			}
+		case "fetch":
+			fetchFlags := flag.NewFlagSet("fetch", flag.ExitOnError)
+			pin := fetchFlags.String("pin", "", "PIN to use if the peer requires one")
+			all := fetchFlags.Bool("all", false, "Download all files without asking")
+			fetchFlags.Parse(args[1:])
+			if fetchFlags.NArg() > 0 {
+				FetchMode(fetchFlags.Arg(0), *pin, *all)
+			} else {
+				logger.Error("Need device IP or alias")
+				ExitMode()
+			}
 		case "help":
 			showHelp()
 			ExitMode()
@@ -404,26 +529,40 @@ func showHelp() {
 	fmt.Println()
 	fmt.Println("Commands:")
 	fmt.Println("  send <file_path>    Send a file to a device on the local network")
+	fmt.Println("    --pin=<pin>       PIN to use if the receiver requires one")
 	fmt.Println("  receive             Wait for incoming files from other devices")
+	fmt.Println("    --pin=<pin>       Require senders to enter this PIN")
+	fmt.Println("  share <paths...>    Share files so other devices can download them")
+	fmt.Println("    --pin=<pin>       Require downloaders to enter this PIN")
+	fmt.Println("  fetch <ip|alias>    Download files shared by another device")
+	fmt.Println("    --pin=<pin>       PIN to use if the peer requires one")
+	fmt.Println("    --all             Download all files without asking")
+	fmt.Println("  devices             List the devices remembered from earlier runs")
+	fmt.Println("  devices forget <fingerprint|alias|ip>")
+	fmt.Println("                      Forget a remembered device")
+	fmt.Println("    --all             Forget all remembered devices")
 	fmt.Println("  web                 Start the web file server with QR code")
 	fmt.Println("  help                Display this help information")
 	fmt.Println()
 	fmt.Println("Options:")
 	fmt.Println("  --help              Display this help information")
-	fmt.Println("  --port=<number>     Specify server port (default: 53317)")
+	fmt.Println("  --port=<number>     Specify server port (default: 53317, or port from config)")
 	fmt.Println("  --config=<path>     Specify config file path (default: ./localsend.yaml)")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  localsend-go send photo.jpg          Send a file (interactive device selection)")
 	fmt.Println("  localsend-go send /path/to/file.zip  Send a file using an absolute path")
 	fmt.Println("  localsend-go receive                 Receive files from other devices")
+	fmt.Println("  localsend-go receive --pin=1234      Receive files only from senders knowing the PIN")
+	fmt.Println("  localsend-go share a.txt photos/      Let other devices download files")
+	fmt.Println("  localsend-go fetch \"Happy Phoenix\"   Download files shared by a device")
 	fmt.Println("  localsend-go --port=8080 web         Start web server on port 8080")
 	fmt.Println()
 	fmt.Println("Running without arguments starts the interactive TUI.")
 }
 
 func init() {
-	flag.IntVar(&port, "port", 53317, "Port to listen on")
+	flag.IntVar(&port, "port", 0, "Port to listen on (overrides the config)")
 	flag.StringVar(&configPath, "config", "", "Path to config file")
 	flag.Usage = showHelp
 }
@@ -440,7 +579,37 @@ func main() {
 	logger.InitLogger()
 	flag.Parse()
 	config.LoadConfig(configPath)
-	shared.InitMessage()
+	if port != 0 {
+		config.ConfigData.Port = port
+	}
+	port = config.ConfigData.Port
+
+	// Managing the device state file needs neither the server nor discovery
+	if flag.Arg(0) == "devices" {
+		if err := DevicesMode(flag.Args()[1:]); err != nil {
+			logger.Failed(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var cert *tls.Certificate
+	var deviceFingerprint string
+	if config.ConfigData.Protocol == "https" {
+		c, err := server.LoadCertificate(config.ConfigData.TLSCert, config.ConfigData.TLSKey, config.ConfigData.ConfigDir)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		cert = &c
+		deviceFingerprint = fingerprint.FromCertificate(c)
+	} else {
+		id, err := fingerprint.LoadOrCreate(config.ConfigData.ConfigDir)
+		if err != nil {
+			log.Fatalf("Failed to load device fingerprint: %v", err)
+		}
+		deviceFingerprint = id
+	}
+	shared.InitMessage(deviceFingerprint)
 
 	// Start HTTP server
 	httpServer := server.New()
@@ -450,11 +619,17 @@ func main() {
 		httpServer.HandleFunc("/api/localsend/v2/prepare-upload", handlers.PrepareReceive)
 		httpServer.HandleFunc("/api/localsend/v2/upload", handlers.ReceiveHandler)
 		httpServer.HandleFunc("/api/localsend/v2/info", handlers.GetInfoHandler)
+		httpServer.HandleFunc("/api/localsend/v2/register", handlers.RegisterHandler)
 		httpServer.HandleFunc("/api/localsend/v2/cancel", handlers.HandleCancel)
+		httpServer.HandleFunc("/api/localsend/v2/prepare-download", handlers.PrepareDownloadHandler)
+		httpServer.HandleFunc("/api/localsend/v2/download", handlers.DownloadHandler)
+		handlers.CleanupPartFiles()
+		handlers.StartSessionCleanup()
 	}
 	go func() {
-		logger.Info("Server started at :" + fmt.Sprintf("%d", port))
-		if err := http.ListenAndServe(":"+fmt.Sprintf("%d", port), httpServer); err != nil {
+		addr := net.JoinHostPort(config.ConfigData.BindAddress, strconv.Itoa(port))
+		logger.Infof("Server started at %s (%s)", addr, config.ConfigData.Protocol)
+		if err := server.ListenAndServe(addr, httpServer, cert); err != nil {
 			log.Fatalf("Server failed: %v", err)
 		}
 	}()
@@ -482,7 +657,7 @@ func main() {
 				fmt.Println("Send mode requires a file path")
 				os.Exit(1)
 			}
-			SendMode(filePath)
+			SendMode(filePath, "")
 		}
 
 		if mode == "📥 Receive" {